@@ -0,0 +1,190 @@
+package identitydoc
+
+import (
+	"errors"
+)
+
+var errBER = errors.New("identitydoc: malformed BER")
+
+const (
+	// maxPKCS7Size bounds the signatures we'll decode. The metadata server's
+	// are a few KB.
+	maxPKCS7Size = 64 << 10
+	// maxBERDepth bounds the nesting of BER elements. SignedData nests about
+	// ten deep.
+	maxBERDepth = 32
+)
+
+// berToDER re-encodes the subset of BER produced by common PKCS7 signers as
+// DER, so it can be parsed by encoding/asn1. Indefinite lengths are replaced
+// with definite ones, and constructed octet strings are flattened. It doesn't
+// sort sets or otherwise canonicalise, signed attributes must already be DER
+// for their signature to verify.
+func berToDER(ber []byte) ([]byte, error) {
+	if len(ber) > maxPKCS7Size {
+		return nil, errBER
+	}
+	out := make([]byte, 0, len(ber))
+	rest, out, err := convertBER(ber, out, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errBER
+	}
+	return out, nil
+}
+
+// convertBER converts the first element of b, appending it to out. It returns
+// the remaining bytes and the extended output. Everything is written to the
+// one buffer, a constructed element's length is inserted once it's children
+// have been converted.
+func convertBER(b, out []byte, depth int) ([]byte, []byte, error) {
+	if depth > maxBERDepth || len(b) < 2 {
+		return nil, nil, errBER
+	}
+	// Tag. High tag numbers span multiple bytes.
+	tagLen := 1
+	if b[0]&0x1f == 0x1f {
+		for tagLen < len(b) && b[tagLen]&0x80 != 0 {
+			tagLen++
+		}
+		tagLen++
+	}
+	if tagLen >= len(b) {
+		return nil, nil, errBER
+	}
+	tag := b[:tagLen]
+	constructed := b[0]&0x20 != 0
+	b = b[tagLen:]
+
+	// Length.
+	var (
+		content    []byte
+		indefinite bool
+	)
+	switch l := b[0]; {
+	case l == 0x80:
+		if !constructed {
+			return nil, nil, errBER
+		}
+		indefinite = true
+		b = b[1:]
+	case l < 0x80:
+		if len(b) < 1+int(l) {
+			return nil, nil, errBER
+		}
+		content, b = b[1:1+int(l)], b[1+int(l):]
+	default:
+		n := int(l & 0x7f)
+		if n > 4 || len(b) < 1+n {
+			return nil, nil, errBER
+		}
+		length := 0
+		for _, c := range b[1 : 1+n] {
+			length = length<<8 | int(c)
+		}
+		b = b[1+n:]
+		if length < 0 || len(b) < length {
+			return nil, nil, errBER
+		}
+		content, b = b[:length], b[length:]
+	}
+
+	if !constructed {
+		out = append(out, tag...)
+		out = appendLength(out, len(content))
+		return b, append(out, content...), nil
+	}
+
+	octets := tagLen == 1 && tag[0] == 0x24
+	if octets {
+		// A constructed octet string, it's pieces are concatenated in to a
+		// primitive one.
+		out = append(out, 0x04)
+	} else {
+		out = append(out, tag...)
+	}
+	start := len(out)
+
+	// Convert the children.
+	var err error
+	if indefinite {
+		for {
+			if len(b) >= 2 && b[0] == 0 && b[1] == 0 {
+				b = b[2:]
+				break
+			}
+			if b, out, err = convertBER(b, out, depth+1); err != nil {
+				return nil, nil, err
+			}
+		}
+	} else {
+		for len(content) > 0 {
+			if content, out, err = convertBER(content, out, depth+1); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	if octets {
+		n, err := flattenOctets(out[start:])
+		if err != nil {
+			return nil, nil, err
+		}
+		out = out[:start+n]
+	}
+	return b, insertLength(out, start), nil
+}
+
+// flattenOctets concatenates the contents of a run of DER octet strings in
+// place, returning the length of the result.
+func flattenOctets(b []byte) (int, error) {
+	w := 0
+	for r := 0; r < len(b); {
+		if b[r] != 0x04 || len(b) < r+2 {
+			return 0, errBER
+		}
+		l, n := int(b[r+1]), 2
+		if l >= 0x80 {
+			ll := l & 0x7f
+			if ll > 4 || len(b) < r+2+ll {
+				return 0, errBER
+			}
+			l = 0
+			for _, c := range b[r+2 : r+2+ll] {
+				l = l<<8 | int(c)
+			}
+			n += ll
+		}
+		if l < 0 || len(b) < r+n+l {
+			return 0, errBER
+		}
+		// The write position never passes the read position, the headers
+		// are dropped.
+		w += copy(b[w:], b[r+n:r+n+l])
+		r += n + l
+	}
+	return w, nil
+}
+
+// insertLength inserts the DER length of out[start:] at start.
+func insertLength(out []byte, start int) []byte {
+	l := appendLength(nil, len(out)-start)
+	out = append(out, l...)
+	copy(out[start+len(l):], out[start:len(out)-len(l)])
+	copy(out[start:], l)
+	return out
+}
+
+func appendLength(out []byte, l int) []byte {
+	if l < 0x80 {
+		return append(out, byte(l))
+	}
+	var buf []byte
+	for ; l > 0; l >>= 8 {
+		buf = append([]byte{byte(l)}, buf...)
+	}
+	out = append(out, 0x80|byte(len(buf)))
+	return append(out, buf...)
+}
@@ -0,0 +1,77 @@
+package identitydoc
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestBERToDER(t *testing.T) {
+	ber := []byte{
+		0x30, 0x80, // SEQUENCE, indefinite
+		0x24, 0x80, // constructed OCTET STRING, indefinite
+		0x04, 0x02, 'a', 'b',
+		0x04, 0x01, 'c',
+		0x00, 0x00,
+		0x02, 0x01, 0x05, // INTEGER 5
+		0x00, 0x00,
+	}
+	want := []byte{0x30, 0x08, 0x04, 0x03, 'a', 'b', 'c', 0x02, 0x01, 0x05}
+	got, err := berToDER(ber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("want % x, got % x", want, got)
+	}
+
+	if _, err := berToDER([]byte{0x30, 0x80, 0x02, 0x01}); err == nil {
+		t.Error("want error for truncated BER")
+	}
+}
+
+func TestBERToDERLongLengths(t *testing.T) {
+	// Pieces long enough to need multi-byte lengths once joined.
+	piece := bytes.Repeat([]byte{'x'}, 100)
+	ber := []byte{0x30, 0x80, 0x24, 0x80}
+	for i := 0; i < 3; i++ {
+		ber = append(ber, 0x04, 100)
+		ber = append(ber, piece...)
+	}
+	ber = append(ber, 0x00, 0x00, 0x00, 0x00)
+
+	want := []byte{0x30, 0x82, 0x01, 0x30, 0x04, 0x82, 0x01, 0x2c}
+	want = append(want, bytes.Repeat([]byte{'x'}, 300)...)
+	got, err := berToDER(ber)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("want % x, got % x", want, got)
+	}
+}
+
+func TestBERToDERLimits(t *testing.T) {
+	nested := func(depth int) []byte {
+		b := bytes.Repeat([]byte{0x30, 0x80}, depth)
+		b = append(b, 0x05, 0x00) // NULL
+		return append(b, bytes.Repeat([]byte{0x00, 0x00}, depth)...)
+	}
+	if _, err := berToDER(nested(maxBERDepth)); err != nil {
+		t.Errorf("want nesting to %d accepted, got %v", maxBERDepth, err)
+	}
+	if _, err := berToDER(nested(maxBERDepth + 1)); err == nil {
+		t.Error("want error for deeply nested BER")
+	}
+
+	start := time.Now()
+	if _, err := berToDER(bytes.Repeat([]byte{0x30, 0x80}, maxPKCS7Size/2)); err == nil {
+		t.Error("want error for deeply nested BER")
+	}
+	if _, err := berToDER(make([]byte, maxPKCS7Size+1)); err == nil {
+		t.Error("want error for oversized BER")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Rejecting hostile BER took %s", d)
+	}
+}
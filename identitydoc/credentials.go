@@ -0,0 +1,157 @@
+package identitydoc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/lstoll/grpce/reporters"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+// Metadata keys the document and signature are sent under. They are binary
+// keys, so grpc base64 encodes them on the wire.
+const (
+	DocumentMetadataKey  = "x-identity-document-bin"
+	SignatureMetadataKey = "x-identity-signature-bin"
+)
+
+type credentialsOptions struct {
+	client        *Client
+	insecure      bool
+	errorReporter reporters.ErrorReporter
+}
+
+// CredentialsOption configures PerRPCCredentials.
+type CredentialsOption func(*credentialsOptions)
+
+// WithMetadataClient sets the client the document and signature are fetched
+// with. It's cache TTL controls how often they are refreshed.
+func WithMetadataClient(c *Client) CredentialsOption {
+	return func(o *credentialsOptions) {
+		o.client = c
+	}
+}
+
+// WithoutTransportSecurity allows the document to be sent on connections
+// without transport security. Anyone who sees it can replay it until it's
+// signature is no longer trusted, so this is only for tests.
+func WithoutTransportSecurity() CredentialsOption {
+	return func(o *credentialsOptions) {
+		o.insecure = true
+	}
+}
+
+// WithCredentialsErrorReporter reports failed refreshes that were covered by
+// a previously fetched document.
+func WithCredentialsErrorReporter(er reporters.ErrorReporter) CredentialsOption {
+	return func(o *credentialsOptions) {
+		o.errorReporter = er
+	}
+}
+
+// refreshRetryInterval is how long to wait after a failed refresh before
+// trying again, so an unresponsive metadata server isn't retried on every
+// request.
+const refreshRetryInterval = 10 * time.Second
+
+// PerRPCCredentials attaches the instance's identity document and signature to
+// every request, so servers can identify the instance calling them.
+type PerRPCCredentials struct {
+	opts *credentialsOptions
+
+	mu        sync.Mutex
+	document  []byte
+	signature []byte
+	// refreshing is set while a background refresh is in flight, and
+	// retryAfter holds off the next one after a failure.
+	refreshing bool
+	retryAfter time.Time
+}
+
+var _ credentials.PerRPCCredentials = (*PerRPCCredentials)(nil)
+
+// NewPerRPCCredentials returns credentials that fetch the document and
+// signature from the metadata server. By default they are cached for the life
+// of the process, pass a client with WithCacheTTL to refresh them. They are
+// only sent over connections with transport security.
+func NewPerRPCCredentials(opts ...CredentialsOption) *PerRPCCredentials {
+	o := &credentialsOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.client == nil {
+		o.client = NewClient()
+	}
+	return &PerRPCCredentials{opts: o}
+}
+
+// GetRequestMetadata returns the document and signature. Only the first call
+// waits for them to be fetched, after that the last ones fetched are returned
+// straight away and refreshed in the background, so a slow or failing
+// metadata server doesn't hold up or fail requests. It only fails if they
+// have never been fetched.
+func (p *PerRPCCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	p.mu.Lock()
+	doc, sig := p.document, p.signature
+	if doc != nil && !p.refreshing && !time.Now().Before(p.retryAfter) {
+		p.refreshing = true
+		go p.refresh()
+	}
+	p.mu.Unlock()
+
+	if doc == nil {
+		var err error
+		doc, sig, err = p.opts.client.DocumentAndSignature(ctx)
+		if err != nil {
+			return nil, err
+		}
+		p.mu.Lock()
+		p.document, p.signature = doc, sig
+		p.mu.Unlock()
+	}
+	return map[string]string{
+		DocumentMetadataKey:  string(doc),
+		SignatureMetadataKey: string(sig),
+	}, nil
+}
+
+// refresh fetches the document and signature in the background. How often
+// they are actually re-fetched is up to the client's cache TTL.
+func (p *PerRPCCredentials) refresh() {
+	doc, sig, err := p.opts.client.DocumentAndSignature(context.Background())
+
+	p.mu.Lock()
+	p.refreshing = false
+	if err != nil {
+		p.retryAfter = time.Now().Add(refreshRetryInterval)
+	} else {
+		p.document, p.signature = doc, sig
+	}
+	p.mu.Unlock()
+
+	if err != nil {
+		reporters.ReportError(p.opts.errorReporter, err)
+	}
+}
+
+// RequireTransportSecurity is true unless WithoutTransportSecurity was given.
+func (p *PerRPCCredentials) RequireTransportSecurity() bool {
+	return !p.opts.insecure
+}
+
+// FromIncomingContext returns the document and signature sent with a request
+// by PerRPCCredentials, for a server to verify. ok is false if either is
+// missing.
+func FromIncomingContext(ctx context.Context) (document, signature []byte, ok bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, nil, false
+	}
+	docs, sigs := md.Get(DocumentMetadataKey), md.Get(SignatureMetadataKey)
+	if len(docs) != 1 || len(sigs) != 1 {
+		return nil, nil, false
+	}
+	return []byte(docs[0]), []byte(sigs[0]), true
+}
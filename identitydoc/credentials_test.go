@@ -0,0 +1,136 @@
+package identitydoc
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lstoll/grpce/helloproto"
+	"github.com/lstoll/grpce/reporters/reporterstest"
+	"google.golang.org/grpc"
+)
+
+// helloIdentity replies with the identity sent with the request.
+type helloIdentity struct{}
+
+func (helloIdentity) HelloWorld(ctx context.Context, req *helloproto.HelloRequest) (*helloproto.HelloResponse, error) {
+	doc, sig, ok := FromIncomingContext(ctx)
+	if !ok {
+		return &helloproto.HelloResponse{}, nil
+	}
+	return &helloproto.HelloResponse{Message: string(doc), ServerName: string(sig)}, nil
+}
+
+func TestPerRPCCredentials(t *testing.T) {
+	f := newFakeIMDS()
+	// hang, when set, holds every metadata request until it's closed.
+	var (
+		mu   sync.Mutex
+		hang chan struct{}
+		reqs int
+	)
+	imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		h := hang
+		reqs++
+		mu.Unlock()
+		if h != nil {
+			<-h
+			return
+		}
+		f.ServeHTTP(w, r)
+	}))
+	defer imds.Close()
+	newClient := func() *Client {
+		return NewClient(WithBaseURL(imds.URL), WithCacheTTL(time.Nanosecond),
+			WithTimeout(100*time.Millisecond), WithTokenTimeout(100*time.Millisecond))
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	helloproto.RegisterHelloServer(s, helloIdentity{})
+	go s.Serve(ln)
+	defer s.Stop()
+
+	ec := &reporterstest.ErrorCollector{}
+	creds := NewPerRPCCredentials(
+		WithMetadataClient(newClient()),
+		WithCredentialsErrorReporter(ec),
+	)
+	if !creds.RequireTransportSecurity() {
+		t.Error("want transport security required by default")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := grpc.DialContext(ctx, ln.Addr().String(), grpc.WithInsecure(), grpc.WithPerRPCCredentials(creds)); err == nil {
+		t.Fatal("want an insecure dial refused")
+	}
+
+	creds = NewPerRPCCredentials(
+		WithMetadataClient(newClient()),
+		WithCredentialsErrorReporter(ec),
+		WithoutTransportSecurity(),
+	)
+	conn, err := grpc.DialContext(ctx, ln.Addr().String(), grpc.WithInsecure(), grpc.WithPerRPCCredentials(creds))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := helloproto.NewHelloClient(conn)
+
+	resp, err := client.HelloWorld(ctx, &helloproto.HelloRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Message != testDoc || resp.ServerName != testSig {
+		t.Errorf("want the document and signature sent, got %q and %q", resp.Message, resp.ServerName)
+	}
+
+	// A hung metadata server doesn't hold up requests, the last fetched
+	// values are sent while it's refreshed in the background.
+	release := make(chan struct{})
+	defer close(release)
+	mu.Lock()
+	hang = release
+	mu.Unlock()
+	start := time.Now()
+	resp, err = client.HelloWorld(ctx, &helloproto.HelloRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d >= 100*time.Millisecond {
+		t.Errorf("want the request sent without waiting for the metadata server, took %s", d)
+	}
+	if resp.Message != testDoc {
+		t.Errorf("want the last document sent, got %q", resp.Message)
+	}
+	for deadline := time.Now().Add(5 * time.Second); len(ec.Errors()) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("want the failed refresh reported")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// After a failure the metadata server isn't retried on every request.
+	mu.Lock()
+	before := reqs
+	mu.Unlock()
+	for i := 0; i < 3; i++ {
+		if _, err := client.HelloWorld(ctx, &helloproto.HelloRequest{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mu.Lock()
+	after := reqs
+	mu.Unlock()
+	if after != before {
+		t.Errorf("want no refreshes within the retry interval, got %d requests", after-before)
+	}
+}
@@ -1,8 +1,8 @@
 package identitydoc
 
 import (
+	"bytes"
 	"crypto/x509"
-	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
@@ -16,39 +16,45 @@ var ErrInvalidDocument = errors.New("The provided identify document does not mat
 // ErrUnknownRegion indicates no certificate was found for the given region
 var ErrUnknownRegion = errors.New("Certificate not found for the provided region")
 
-const genericAWSPublicCertificateIdentity = `-----BEGIN CERTIFICATE-----
-MIIDIjCCAougAwIBAgIJAKnL4UEDMN/FMA0GCSqGSIb3DQEBBQUAMGoxCzAJBgNV
-BAYTAlVTMRMwEQYDVQQIEwpXYXNoaW5ndG9uMRAwDgYDVQQHEwdTZWF0dGxlMRgw
-FgYDVQQKEw9BbWF6b24uY29tIEluYy4xGjAYBgNVBAMTEWVjMi5hbWF6b25hd3Mu
-Y29tMB4XDTE0MDYwNTE0MjgwMloXDTI0MDYwNTE0MjgwMlowajELMAkGA1UEBhMC
-VVMxEzARBgNVBAgTCldhc2hpbmd0b24xEDAOBgNVBAcTB1NlYXR0bGUxGDAWBgNV
-BAoTD0FtYXpvbi5jb20gSW5jLjEaMBgGA1UEAxMRZWMyLmFtYXpvbmF3cy5jb20w
-gZ8wDQYJKoZIhvcNAQEBBQADgY0AMIGJAoGBAIe9GN//SRK2knbjySG0ho3yqQM3
-e2TDhWO8D2e8+XZqck754gFSo99AbT2RmXClambI7xsYHZFapbELC4H91ycihvrD
-jbST1ZjkLQgga0NE1q43eS68ZeTDccScXQSNivSlzJZS8HJZjgqzBlXjZftjtdJL
-XeE4hwvo0sD4f3j9AgMBAAGjgc8wgcwwHQYDVR0OBBYEFCXWzAgVyrbwnFncFFIs
-77VBdlE4MIGcBgNVHSMEgZQwgZGAFCXWzAgVyrbwnFncFFIs77VBdlE4oW6kbDBq
-MQswCQYDVQQGEwJVUzETMBEGA1UECBMKV2FzaGluZ3RvbjEQMA4GA1UEBxMHU2Vh
-dHRsZTEYMBYGA1UEChMPQW1hem9uLmNvbSBJbmMuMRowGAYDVQQDExFlYzIuYW1h
-em9uYXdzLmNvbYIJAKnL4UEDMN/FMAwGA1UdEwQFMAMBAf8wDQYJKoZIhvcNAQEF
-BQADgYEAFYcz1OgEhQBXIwIdsgCOS8vEtiJYF+j9uO6jz7VOmJqO+pRlAbRlvY8T
-C1haGgSI/A1uZUKs/Zfnph0oEI0/hu1IIJ/SKBDtN5lvmZ/IzbOPIJWirlsllQIQ
-7zvWbGd9c9+Rm3p04oTvhup99la7kZqevJK0QRdD/6NpCKsqP/0=
+// genericAWSDSACertificate verifies the DSA signed PKCS7 from the pkcs7
+// endpoint.
+const genericAWSDSACertificate = `-----BEGIN CERTIFICATE-----
+MIIC7TCCAq0CCQCWukjZ5V4aZzAJBgcqhkjOOAQDMFwxCzAJBgNVBAYTAlVTMRkw
+FwYDVQQIExBXYXNoaW5ndG9uIFN0YXRlMRAwDgYDVQQHEwdTZWF0dGxlMSAwHgYD
+VQQKExdBbWF6b24gV2ViIFNlcnZpY2VzIExMQzAeFw0xMjAxMDUxMjU2MTJaFw0z
+ODAxMDUxMjU2MTJaMFwxCzAJBgNVBAYTAlVTMRkwFwYDVQQIExBXYXNoaW5ndG9u
+IFN0YXRlMRAwDgYDVQQHEwdTZWF0dGxlMSAwHgYDVQQKExdBbWF6b24gV2ViIFNl
+cnZpY2VzIExMQzCCAbcwggEsBgcqhkjOOAQBMIIBHwKBgQCjkvcS2bb1VQ4yt/5e
+ih5OO6kK/n1Lzllr7D8ZwtQP8fOEpp5E2ng+D6Ud1Z1gYipr58Kj3nssSNpI6bX3
+VyIQzK7wLclnd/YozqNNmgIyZecN7EglK9ITHJLP+x8FtUpt3QbyYXJdmVMegN6P
+hviYt5JH/nYl4hh3Pa1HJdskgQIVALVJ3ER11+Ko4tP6nwvHwh6+ERYRAoGBAI1j
+k+tkqMVHuAFcvAGKocTgsjJem6/5qomzJuKDmbJNu9Qxw3rAotXau8Qe+MBcJl/U
+hhy1KHVpCGl9fueQ2s6IL0CaO/buycU1CiYQk40KNHCcHfNiZbdlx1E9rpUp7bnF
+lRa2v1ntMX3caRVDdbtPEWmdxSCYsYFDk4mZrOLBA4GEAAKBgEbmeve5f8LIE/Gf
+MNmP9CM5eovQOGx5ho8WqD+aTebs+k2tn92BBPqeZqpWRa5P/+jrdKml1qx4llHW
+MXrs3IgIb6+hUIB+S8dz8/mmO0bpr76RoZVCXYab2CZedFut7qc3WUH9+EUAH5mw
+vSeDCOUMYQR7R9LINYwouHIziqQYMAkGByqGSM44BAMDLwAwLAIUWXBlk40xTwSw
+7HX32MxXYruse9ACFBNGmdX2ZBrVNGrN9N2f6ROk0k9K
 -----END CERTIFICATE-----`
 
-var (
-	awsCert *x509.Certificate
-
-	awsCertPEM, _ = pem.Decode([]byte(genericAWSPublicCertificateIdentity))
-)
-
 func init() {
-	var err error
-	if awsCert, err = x509.ParseCertificate(awsCertPEM.Bytes); err != nil {
+	dsaPEM, _ := pem.Decode([]byte(genericAWSDSACertificate))
+	dsaCert, err := x509.ParseCertificate(dsaPEM.Bytes)
+	if err != nil {
 		// We are loading static data, if something goes wrong here it's a real
 		// problem
 		panic(err)
 	}
+	for region, certPEM := range awsSignatureCertificates {
+		p, _ := pem.Decode([]byte(certPEM))
+		cert, err := x509.ParseCertificate(p.Bytes)
+		if err != nil {
+			panic(err)
+		}
+		DefaultVerifier.Add(RawSignature, region, cert)
+		// The generic DSA certificate signs for the same regions.
+		DefaultVerifier.Add(PKCS7Signature, region, dsaCert)
+	}
 }
 
 // InstanceIdentityDocument represents the information contained in an instances
@@ -66,35 +72,49 @@ type InstanceIdentityDocument struct {
 
 	Doc json.RawMessage `json:"-"`
 	Sig []byte          `json:"-"`
+	// PKCS7 is the DER encoded signature, if the document was verified from
+	// one. Sig is empty in that case.
+	PKCS7 []byte `json:"-"`
+	// Kind is the kind of signature the document was verified with.
+	Kind SignatureKind `json:"-"`
+
+	// verifier is the verifier the document was verified with.
+	verifier *Verifier
 }
 
 // VerifyDocumentAndSignature will confirm that the document is correct by
-// validating it against the signature and cert for the given region. It will
-// return the parsed document if it's valid, or ErrInvalidDocument if it's not.
+// validating it against the signature and DefaultVerifier for the given
+// region. It will return the parsed document if it's valid, or
+// ErrInvalidDocument if it's not.
 // Document is the data returned from:
 // http://169.254.169.254/latest/dynamic/instance-identity/document
 // Signature is returned from:
 // http://169.254.169.254/latest/dynamic/instance-identity/signature
-// If the region is unknown or has no cert, ErrUnknownRegion region will be
-// returned. If there are any other errors, the error will be passed on.
+// If the region has no certificates, ErrUnknownRegion will be returned, and if
+// none of them are currently valid ErrCertificateExpired. If the document is
+// for a different region ErrRegionMismatch is returned. If there are any other
+// errors, the error will be passed on.
 func VerifyDocumentAndSignature(region string, document, signature []byte) (*InstanceIdentityDocument, error) {
-	rawSig, err := base64.StdEncoding.DecodeString(string(signature))
-	if err != nil {
-		return nil, err
-	}
-
-	iid := &InstanceIdentityDocument{
-		Doc: document,
-		Sig: rawSig,
-	}
-
-	if err := json.Unmarshal(document, iid); err != nil {
-		return nil, ErrInvalidDocument
-	}
-
-	return iid, iid.CheckSignature()
+	return DefaultVerifier.VerifyDocumentAndSignature(region, document, signature)
 }
 
+// CheckSignature re-checks the document's signature for it's region, against
+// the verifier that verified it. Documents that weren't verified, e.g
+// unmarshalled ones, are checked against DefaultVerifier.
 func (d InstanceIdentityDocument) CheckSignature() error {
-	return awsCert.CheckSignature(x509.SHA256WithRSA, d.Doc, d.Sig)
+	v := d.verifier
+	if v == nil {
+		v = DefaultVerifier
+	}
+	if len(d.PKCS7) > 0 {
+		content, err := v.checkPKCS7(d.Kind, d.Region, d.PKCS7)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(content, d.Doc) {
+			return ErrInvalidDocument
+		}
+		return nil
+	}
+	return v.check(d.Region, &d)
 }
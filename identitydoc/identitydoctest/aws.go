@@ -0,0 +1,50 @@
+package identitydoctest
+
+// Real documents and signatures from the metadata server, for tests that need
+// to verify against AWS's own certificates.
+const (
+	// AWSDocument is a document for 172.30.0.208 in account 021124591875, in
+	// us-east-1.
+	AWSDocument = `{
+  "devpayProductCodes" : null,
+  "privateIp" : "172.30.0.208",
+  "availabilityZone" : "us-east-1a",
+  "accountId" : "021124591875",
+  "version" : "2010-08-31",
+  "instanceId" : "i-1ddaabe5",
+  "billingProducts" : null,
+  "instanceType" : "t2.nano",
+  "pendingTime" : "2016-09-03T15:07:45Z",
+  "architecture" : "x86_64",
+  "imageId" : "ami-2d39803a",
+  "kernelId" : null,
+  "ramdiskId" : null,
+  "region" : "us-east-1"
+}`
+
+	// AWSSignature is AWSDocument's signature, from the signature endpoint.
+	AWSSignature = `Ob3mEexQi/91fA/HMqS7L1DraJ/8T/lAblai/PrSgx6FMMPpQpi2rftc/iUcs4Uufzq0NjXkwk95
+9cRES6s3T36hWgob/cutg5imhdy5++bymuzE8Z6T35pU3y3kn4eS6Yebna1atVbAFifeAqySGXCZ
+l5+VTbjj/MBI7vB1cEs=`
+
+	// AWSPKCS7 is a signature from the pkcs7 endpoint, for 172.30.0.252 in
+	// account 121659014334, in us-east-1. It's DSA signed, and BER encoded.
+	// From the tests of github.com/fullsailor/pkcs7.
+	AWSPKCS7 = `MIAGCSqGSIb3DQEHAqCAMIACAQExCzAJBgUrDgMCGgUAMIAGCSqGSIb3DQEHAaCA
+JIAEggGmewogICJwcml2YXRlSXAiIDogIjE3Mi4zMC4wLjI1MiIsCiAgImRldnBh
+eVByb2R1Y3RDb2RlcyIgOiBudWxsLAogICJhdmFpbGFiaWxpdHlab25lIiA6ICJ1
+cy1lYXN0LTFhIiwKICAidmVyc2lvbiIgOiAiMjAxMC0wOC0zMSIsCiAgImluc3Rh
+bmNlSWQiIDogImktZjc5ZmU1NmMiLAogICJiaWxsaW5nUHJvZHVjdHMiIDogbnVs
+bCwKICAiaW5zdGFuY2VUeXBlIiA6ICJ0Mi5taWNybyIsCiAgImFjY291bnRJZCIg
+OiAiMTIxNjU5MDE0MzM0IiwKICAiaW1hZ2VJZCIgOiAiYW1pLWZjZTNjNjk2IiwK
+ICAicGVuZGluZ1RpbWUiIDogIjIwMTYtMDQtMDhUMDM6MDE6MzhaIiwKICAiYXJj
+aGl0ZWN0dXJlIiA6ICJ4ODZfNjQiLAogICJrZXJuZWxJZCIgOiBudWxsLAogICJy
+YW1kaXNrSWQiIDogbnVsbCwKICAicmVnaW9uIiA6ICJ1cy1lYXN0LTEiCn0AAAAA
+AAAxggEYMIIBFAIBATBpMFwxCzAJBgNVBAYTAlVTMRkwFwYDVQQIExBXYXNoaW5n
+dG9uIFN0YXRlMRAwDgYDVQQHEwdTZWF0dGxlMSAwHgYDVQQKExdBbWF6b24gV2Vi
+IFNlcnZpY2VzIExMQwIJAJa6SNnlXhpnMAkGBSsOAwIaBQCgXTAYBgkqhkiG9w0B
+CQMxCwYJKoZIhvcNAQcBMBwGCSqGSIb3DQEJBTEPFw0xNjA0MDgwMzAxNDRaMCMG
+CSqGSIb3DQEJBDEWBBTuUc28eBXmImAautC+wOjqcFCBVjAJBgcqhkjOOAQDBC8w
+LQIVAKA54NxGHWWCz5InboDmY/GHs33nAhQ6O/ZI86NwjA9Vz3RNMUJrUPU5tAAA
+AAAAAA==`
+)
@@ -0,0 +1,231 @@
+// Package identitydoctest signs instance identity documents with a throwaway
+// certificate, so code consuming them can be tested without real AWS signed
+// documents.
+//
+//	s := identitydoctest.NewSigner()
+//	doc := identitydoctest.Document(identitydoc.InstanceIdentityDocument{
+//		InstanceID: "i-1234",
+//		AccountID:  "123456789012",
+//		PrivateIP:  "10.0.0.1",
+//		Region:     "us-east-1",
+//	})
+//	iid, err := s.Verifier().VerifyDocumentAndSignature("us-east-1", doc, s.Sign(doc))
+package identitydoctest
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/lstoll/grpce/identitydoc"
+)
+
+// Signer signs documents with a throwaway self-signed certificate.
+type Signer struct {
+	// Certificate is the certificate documents are verified against.
+	Certificate *x509.Certificate
+	// Key is the certificate's private key.
+	Key *rsa.PrivateKey
+	// OmitSignedAttributes makes PKCS7 signatures directly over the document,
+	// as some signers do, rather than over signed attributes.
+	OmitSignedAttributes bool
+}
+
+// NewSigner generates a new key and certificate, valid for a day either side
+// of now. It panics on failure, as it's only for tests.
+func NewSigner() *Signer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		panic(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "identitydoctest", Organization: []string{"Test"}},
+		NotBefore:             time.Now().Add(-24 * time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+	return &Signer{Certificate: cert, Key: key}
+}
+
+// Verifier returns a verifier that trusts the signer for every kind of
+// signature, in every region.
+func (s *Signer) Verifier() *identitydoc.Verifier {
+	v := identitydoc.NewVerifier()
+	for _, k := range identitydoc.SignatureKinds {
+		for _, p := range []string{identitydoc.PartitionAWS, identitydoc.PartitionAWSCN, identitydoc.PartitionAWSUSGov} {
+			v.SetPartition(k, p, s.Certificate)
+		}
+	}
+	return v
+}
+
+// Document returns the JSON encoding of doc, as served by the metadata
+// server.
+func Document(doc identitydoc.InstanceIdentityDocument) []byte {
+	b, err := json.MarshalIndent(&doc, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Sign returns the base64 encoded RSA signature of the document, as served by
+// the metadata server's signature endpoint.
+func (s *Signer) Sign(document []byte) []byte {
+	sum := sha256.Sum256(document)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.Key, crypto.SHA256, sum[:])
+	if err != nil {
+		panic(err)
+	}
+	return []byte(base64.StdEncoding.EncodeToString(sig))
+}
+
+// SignPKCS7 returns the base64 encoded PKCS7 SignedData envelope of the
+// document, as served by the metadata server's pkcs7 and rsa2048 endpoints.
+// It's RSA signed, the signer's verifier accepts it from VerifyPKCS7 or
+// VerifyRSA2048.
+func (s *Signer) SignPKCS7(document []byte) []byte {
+	return []byte(base64.StdEncoding.EncodeToString(s.SignPKCS7DER(document)))
+}
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSA           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+)
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type issuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+type signerInfo struct {
+	Version            int
+	SID                issuerAndSerial
+	DigestAlgorithm    algorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional"`
+	SignatureAlgorithm algorithmIdentifier
+	Signature          []byte
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     asn1.RawValue
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []algorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	SignerInfos      []signerInfo `asn1:"set"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+// explicit returns v wrapped in a [0] tag.
+func explicit(v interface{}) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: marshal(v)}
+}
+
+func marshal(v interface{}) []byte {
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// SignPKCS7DER returns the DER encoded PKCS7 SignedData envelope of the
+// document. It's signed with SHA-256, with signed attributes unless
+// OmitSignedAttributes is set, like AWS's rsa2048 signatures.
+func (s *Signer) SignPKCS7DER(document []byte) []byte {
+	si := signerInfo{
+		Version:            1,
+		SID:                issuerAndSerial{Issuer: asn1.RawValue{FullBytes: s.Certificate.RawIssuer}, Serial: s.Certificate.SerialNumber},
+		DigestAlgorithm:    algorithmIdentifier{Algorithm: oidSHA256},
+		SignatureAlgorithm: algorithmIdentifier{Algorithm: oidRSA},
+	}
+	signed := document
+	if !s.OmitSignedAttributes {
+		sum := sha256.Sum256(document)
+		attr := func(oid asn1.ObjectIdentifier, v interface{}) []byte {
+			return marshal(attribute{
+				Type:   oid,
+				Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: marshal(v)},
+			})
+		}
+		attrs := [][]byte{
+			attr(oidContentType, oidData),
+			attr(oidSigningTime, time.Now().UTC()),
+			attr(oidMessageDigest, sum[:]),
+		}
+		// DER sorts SET OF by encoding.
+		sort.Slice(attrs, func(i, j int) bool { return bytes.Compare(attrs[i], attrs[j]) < 0 })
+		attrBytes := bytes.Join(attrs, nil)
+		// The signature is over the attributes encoded as a SET.
+		signed = marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrBytes})
+		si.SignedAttrs = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrBytes}
+	}
+	digest := sha256.Sum256(signed)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.Key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	si.Signature = sig
+
+	sd := signedData{
+		Version:          1,
+		DigestAlgorithms: []algorithmIdentifier{{Algorithm: oidSHA256}},
+		EncapContentInfo: encapsulatedContentInfo{
+			EContentType: oidData,
+			EContent:     explicit(document),
+		},
+		SignerInfos: []signerInfo{si},
+	}
+	return marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     explicit(sd),
+	})
+}
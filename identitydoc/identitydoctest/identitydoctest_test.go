@@ -0,0 +1,70 @@
+package identitydoctest
+
+import (
+	"testing"
+
+	"github.com/lstoll/grpce/identitydoc"
+)
+
+func TestSigner(t *testing.T) {
+	s := NewSigner()
+	want := identitydoc.InstanceIdentityDocument{
+		InstanceID: "i-1234",
+		AccountID:  "123456789012",
+		PrivateIP:  "10.0.0.1",
+		Region:     "cn-north-1",
+	}
+	doc := Document(want)
+	v := s.Verifier()
+
+	got, err := v.VerifyDocumentAndSignature("cn-north-1", doc, s.Sign(doc))
+	if err != nil {
+		t.Fatalf("verifying signature: %v", err)
+	}
+	if got.InstanceID != want.InstanceID || got.PrivateIP != want.PrivateIP {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+
+	got, err = v.VerifyPKCS7("cn-north-1", s.SignPKCS7(doc))
+	if err != nil {
+		t.Fatalf("verifying PKCS7: %v", err)
+	}
+	if got.AccountID != want.AccountID {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+	if _, err := v.VerifyRSA2048("cn-north-1", s.SignPKCS7(doc)); err != nil {
+		t.Fatalf("verifying RSA-2048: %v", err)
+	}
+
+	// Documents are re-checked against the verifier that produced them.
+	if err := got.CheckSignature(); err != nil {
+		t.Errorf("want PKCS7 document re-checked with the signer's verifier, got %v", err)
+	}
+	raw, err := v.VerifyDocumentAndSignature("cn-north-1", doc, s.Sign(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := raw.CheckSignature(); err != nil {
+		t.Errorf("want document re-checked with the signer's verifier, got %v", err)
+	}
+	raw.Doc = Document(identitydoc.InstanceIdentityDocument{InstanceID: "i-5678", Region: "cn-north-1"})
+	if err := raw.CheckSignature(); err != identitydoc.ErrInvalidDocument {
+		t.Errorf("want ErrInvalidDocument for a modified document, got %v", err)
+	}
+
+	if _, err := identitydoc.VerifyDocumentAndSignature("cn-north-1", doc, s.Sign(doc)); err == nil {
+		t.Error("want the default verifier to reject the test signer")
+	}
+	if _, err := NewSigner().Verifier().VerifyDocumentAndSignature("cn-north-1", doc, s.Sign(doc)); err == nil {
+		t.Error("want another signer's verifier to reject the signature")
+	}
+}
+
+func TestAWSFixtures(t *testing.T) {
+	if _, err := identitydoc.VerifyDocumentAndSignature("us-east-1", []byte(AWSDocument), []byte(AWSSignature)); err != nil {
+		t.Errorf("verifying AWSDocument: %v", err)
+	}
+	if _, err := identitydoc.VerifyPKCS7("us-east-1", []byte(AWSPKCS7)); err != nil {
+		t.Errorf("verifying AWSPKCS7: %v", err)
+	}
+}
@@ -0,0 +1,338 @@
+package identitydoc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMetadataURL is the base URL of the instance metadata server.
+const DefaultMetadataURL = "http://169.254.169.254"
+
+// Paths of the identity document and it's signatures, relative to the base
+// URL.
+const (
+	DocumentPath  = "/latest/dynamic/instance-identity/document"
+	SignaturePath = "/latest/dynamic/instance-identity/signature"
+	PKCS7Path     = "/latest/dynamic/instance-identity/pkcs7"
+	RSA2048Path   = "/latest/dynamic/instance-identity/rsa2048"
+
+	tokenPath      = "/latest/api/token"
+	tokenHeader    = "X-aws-ec2-metadata-token"
+	tokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+
+	// v1RetryAfter is how long to use IMDSv1 after failing to get a token.
+	v1RetryAfter = 5 * time.Minute
+)
+
+// ErrTokenUnavailable is returned when an IMDSv2 session token can't be
+// obtained, and falling back to IMDSv1 is disabled.
+var ErrTokenUnavailable = errors.New("identitydoc: IMDSv2 session token unavailable")
+
+// MetadataError is returned when a request to the metadata server fails.
+type MetadataError struct {
+	// Path is the path requested.
+	Path string
+	// StatusCode is the HTTP status returned, or 0 if the request failed
+	// before a response was received.
+	StatusCode int
+	// Err is the underlying error, if there was no response.
+	Err error
+}
+
+func (m *MetadataError) Error() string {
+	if m.Err != nil {
+		return fmt.Sprintf("identitydoc: fetching %s from metadata server: %v", m.Path, m.Err)
+	}
+	return fmt.Sprintf("identitydoc: fetching %s from metadata server: status %d", m.Path, m.StatusCode)
+}
+
+type clientOptions struct {
+	baseURL      string
+	httpClient   *http.Client
+	timeout      time.Duration
+	tokenTimeout time.Duration
+	tokenTTL     time.Duration
+	disableV1    bool
+	cacheTTL     time.Duration
+}
+
+// ClientOption configures a Client.
+type ClientOption func(*clientOptions)
+
+// WithBaseURL overrides the metadata server URL, e.g for testing.
+func WithBaseURL(u string) ClientOption {
+	return func(o *clientOptions) {
+		o.baseURL = strings.TrimSuffix(u, "/")
+	}
+}
+
+// WithHTTPClient sets the HTTP client used. It should not use a proxy.
+func WithHTTPClient(c *http.Client) ClientOption {
+	return func(o *clientOptions) {
+		o.httpClient = c
+	}
+}
+
+// WithTimeout bounds each request to the metadata server. The default is 2s.
+func WithTimeout(d time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.timeout = d
+	}
+}
+
+// WithTokenTimeout bounds requests for an IMDSv2 session token. The default
+// is 1s. When the token response's hop limit is too low for the caller, e.g
+// inside a container, the response is dropped and the request hangs, so this
+// should be short.
+func WithTokenTimeout(d time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.tokenTimeout = d
+	}
+}
+
+// WithTokenTTL sets the lifetime requested for IMDSv2 session tokens. The
+// default, and the maximum, is 6 hours.
+func WithTokenTTL(d time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.tokenTTL = d
+	}
+}
+
+// WithoutIMDSv1 disables falling back to IMDSv1 when a session token can't be
+// obtained. ErrTokenUnavailable is returned instead.
+func WithoutIMDSv1() ClientOption {
+	return func(o *clientOptions) {
+		o.disableV1 = true
+	}
+}
+
+// WithCacheTTL sets how long fetched values are cached. The identity document
+// doesn't change for the life of an instance, so by default they are cached
+// forever.
+func WithCacheTTL(d time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.cacheTTL = d
+	}
+}
+
+type cached struct {
+	value   []byte
+	fetched time.Time
+}
+
+// Client fetches the instance identity document and signatures from the
+// instance metadata server. It uses IMDSv2 session tokens, falling back to
+// IMDSv1 if a token can't be obtained. It is safe for concurrent use.
+type Client struct {
+	opts *clientOptions
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+	// v1Until is set when falling back to IMDSv1, so we don't wait on the
+	// token timeout for every request.
+	v1Until time.Time
+	// tokenFetch is the token request in flight, if any.
+	tokenFetch *tokenFetch
+	cache      map[string]cached
+}
+
+// NewClient returns a new metadata client.
+func NewClient(opts ...ClientOption) *Client {
+	o := &clientOptions{
+		baseURL:      DefaultMetadataURL,
+		httpClient:   &http.Client{Transport: &http.Transport{Proxy: nil}},
+		timeout:      2 * time.Second,
+		tokenTimeout: time.Second,
+		tokenTTL:     6 * time.Hour,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &Client{opts: o, cache: map[string]cached{}}
+}
+
+// Document returns the raw instance identity document.
+func (c *Client) Document(ctx context.Context) ([]byte, error) {
+	return c.Get(ctx, DocumentPath)
+}
+
+// Signature returns the base64 encoded signature of the document, as passed
+// to VerifyDocumentAndSignature.
+func (c *Client) Signature(ctx context.Context) ([]byte, error) {
+	return c.Get(ctx, SignaturePath)
+}
+
+// PKCS7 returns the base64 encoded PKCS7 signature of the document, without
+// PEM armour, as passed to VerifyPKCS7.
+func (c *Client) PKCS7(ctx context.Context) ([]byte, error) {
+	return c.Get(ctx, PKCS7Path)
+}
+
+// RSA2048 returns the base64 encoded PKCS7 RSA-2048 signature of the
+// document, without PEM armour, as passed to VerifyRSA2048. This is the
+// signature AWS recommends, and the only one available in some newer regions.
+func (c *Client) RSA2048(ctx context.Context) ([]byte, error) {
+	return c.Get(ctx, RSA2048Path)
+}
+
+// DocumentAndSignature returns the document and it's signature.
+func (c *Client) DocumentAndSignature(ctx context.Context) (document, signature []byte, err error) {
+	if document, err = c.Document(ctx); err != nil {
+		return nil, nil, err
+	}
+	if signature, err = c.Signature(ctx); err != nil {
+		return nil, nil, err
+	}
+	return document, signature, nil
+}
+
+// Get fetches path from the metadata server, or returns it from the cache.
+func (c *Client) Get(ctx context.Context, path string) ([]byte, error) {
+	c.mu.Lock()
+	ce, ok := c.cache[path]
+	c.mu.Unlock()
+	if ok && (c.opts.cacheTTL == 0 || time.Since(ce.fetched) < c.opts.cacheTTL) {
+		return ce.value, nil
+	}
+
+	b, err := c.fetch(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.cache[path] = cached{value: b, fetched: time.Now()}
+	c.mu.Unlock()
+	return b, nil
+}
+
+// fetch GETs path, with a session token if one can be had. If the token is
+// rejected it's discarded and the request retried once with a new one.
+func (c *Client) fetch(ctx context.Context, path string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		token, err := c.getToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+		b, status, err := c.do(ctx, http.MethodGet, path, c.opts.timeout, func(r *http.Request) {
+			if token != "" {
+				r.Header.Set(tokenHeader, token)
+			}
+		})
+		if err != nil {
+			return nil, &MetadataError{Path: path, Err: err}
+		}
+		if status == http.StatusUnauthorized && attempt == 0 {
+			c.mu.Lock()
+			c.token = ""
+			c.mu.Unlock()
+			continue
+		}
+		if status != http.StatusOK {
+			return nil, &MetadataError{Path: path, StatusCode: status}
+		}
+		return b, nil
+	}
+}
+
+// tokenFetch is a token request in flight, shared by everyone waiting on it.
+type tokenFetch struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// getToken returns a current session token, or "" to use IMDSv1. The lock
+// isn't held while a token is requested, so cached values can still be read.
+func (c *Client) getToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	// Refresh a little early, so it doesn't expire in flight.
+	if c.token != "" && time.Now().Add(time.Minute).Before(c.tokenExpiry) {
+		token := c.token
+		c.mu.Unlock()
+		return token, nil
+	}
+	if time.Now().Before(c.v1Until) {
+		c.mu.Unlock()
+		return "", nil
+	}
+	f := c.tokenFetch
+	if f == nil {
+		f = &tokenFetch{done: make(chan struct{})}
+		c.tokenFetch = f
+		go c.fetchToken(f)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.token, f.err
+	case <-ctx.Done():
+		return "", &MetadataError{Path: tokenPath, Err: ctx.Err()}
+	}
+}
+
+// fetchToken requests a new token for f. It isn't bound to any caller's
+// context, so one giving up doesn't fail the others waiting on it.
+func (c *Client) fetchToken(f *tokenFetch) {
+	now := time.Now()
+	ttl := int(c.opts.tokenTTL / time.Second)
+	b, status, err := c.do(context.Background(), http.MethodPut, tokenPath, c.opts.tokenTimeout, func(r *http.Request) {
+		r.Header.Set(tokenTTLHeader, strconv.Itoa(ttl))
+	})
+
+	c.mu.Lock()
+	defer func() {
+		c.tokenFetch = nil
+		c.mu.Unlock()
+		close(f.done)
+	}()
+	if err == nil && status == http.StatusOK {
+		c.token = strings.TrimSpace(string(b))
+		c.tokenExpiry = now.Add(c.opts.tokenTTL)
+		f.token = c.token
+		return
+	}
+	switch status {
+	case 0, http.StatusForbidden, http.StatusNotFound, http.StatusMethodNotAllowed:
+		// Either the response couldn't reach us, or IMDSv2 isn't available.
+	default:
+		f.err = &MetadataError{Path: tokenPath, StatusCode: status}
+		return
+	}
+	if c.opts.disableV1 {
+		f.err = ErrTokenUnavailable
+		return
+	}
+	// Use IMDSv1 for a while before trying again.
+	c.v1Until = now.Add(v1RetryAfter)
+}
+
+// do makes a request, returning the body and status.
+func (c *Client) do(ctx context.Context, method, path string, timeout time.Duration, prepare func(*http.Request)) ([]byte, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequest(method, c.opts.baseURL+path, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req = req.WithContext(ctx)
+	prepare(req)
+	resp, err := c.opts.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	return b, resp.StatusCode, nil
+}
@@ -0,0 +1,213 @@
+package identitydoc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeIMDS is a minimal instance metadata server.
+type fakeIMDS struct {
+	mu sync.Mutex
+	// requireToken rejects requests without a valid token, like an instance
+	// with IMDSv2 enforced.
+	requireToken bool
+	// noV2 returns 404 for token requests, like an old metadata server.
+	noV2 bool
+	// hangToken never answers token requests, like a container beyond the
+	// hop limit.
+	hangToken chan struct{}
+	tokens    map[string]bool
+	tokenTTLs []int
+	gets      int
+}
+
+func newFakeIMDS() *fakeIMDS {
+	return &fakeIMDS{tokens: map[string]bool{}}
+}
+
+func (f *fakeIMDS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == tokenPath {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if f.hangToken != nil {
+			f.mu.Unlock()
+			<-f.hangToken
+			f.mu.Lock()
+			return
+		}
+		if f.noV2 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		ttl, err := strconv.Atoi(r.Header.Get(tokenTTLHeader))
+		if err != nil || ttl < 1 || ttl > 21600 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.tokenTTLs = append(f.tokenTTLs, ttl)
+		tok := "token-" + strconv.Itoa(len(f.tokens))
+		f.tokens[tok] = true
+		w.Write([]byte(tok))
+		return
+	}
+
+	f.gets++
+	tok := r.Header.Get(tokenHeader)
+	if tok != "" && !f.tokens[tok] || tok == "" && f.requireToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch r.URL.Path {
+	case DocumentPath:
+		w.Write([]byte(testDoc))
+	case SignaturePath:
+		w.Write([]byte(testSig))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeIMDS) getCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.gets
+}
+
+func TestClientIMDSv2(t *testing.T) {
+	f := newFakeIMDS()
+	f.requireToken = true
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	c := NewClient(WithBaseURL(srv.URL+"/"), WithTokenTTL(time.Hour))
+	doc, sig, err := c.DocumentAndSignature(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(doc) != testDoc || string(sig) != testSig {
+		t.Errorf("Unexpected document %q and signature %q", doc, sig)
+	}
+	if len(f.tokenTTLs) != 1 || f.tokenTTLs[0] != 3600 {
+		t.Errorf("want a single token requested with a TTL of 3600, got %v", f.tokenTTLs)
+	}
+
+	// Cached.
+	if _, err := c.Document(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.getCount(); n != 2 {
+		t.Errorf("want 2 fetches, got %d", n)
+	}
+
+	// Rejected tokens are replaced.
+	f.mu.Lock()
+	f.tokens = map[string]bool{}
+	f.mu.Unlock()
+	c = NewClient(WithBaseURL(srv.URL), WithCacheTTL(time.Nanosecond))
+	if _, err := c.Document(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	f.tokens = map[string]bool{}
+	f.mu.Unlock()
+	if _, err := c.Document(context.Background()); err != nil {
+		t.Fatalf("want rejected token replaced, got %v", err)
+	}
+
+	_, err = c.Get(context.Background(), "/latest/meta-data/nothing")
+	if me, ok := err.(*MetadataError); !ok || me.StatusCode != http.StatusNotFound {
+		t.Errorf("want a not found MetadataError, got %v", err)
+	}
+}
+
+func TestClientIMDSv1Fallback(t *testing.T) {
+	f := newFakeIMDS()
+	f.noV2 = true
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	if _, err := NewClient(WithBaseURL(srv.URL)).Document(context.Background()); err != nil {
+		t.Fatalf("want fallback to IMDSv1, got %v", err)
+	}
+	if _, err := NewClient(WithBaseURL(srv.URL), WithoutIMDSv1()).Document(context.Background()); err != ErrTokenUnavailable {
+		t.Errorf("want ErrTokenUnavailable with IMDSv1 disabled, got %v", err)
+	}
+}
+
+func TestClientHopLimit(t *testing.T) {
+	f := newFakeIMDS()
+	f.hangToken = make(chan struct{})
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+	defer close(f.hangToken)
+
+	c := NewClient(WithBaseURL(srv.URL), WithTokenTimeout(20*time.Millisecond), WithCacheTTL(time.Nanosecond))
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		if _, err := c.Document(context.Background()); err != nil {
+			t.Fatalf("want fallback to IMDSv1, got %v", err)
+		}
+		// The second fetch shouldn't wait for a token again.
+		if i == 1 && time.Since(start) >= 20*time.Millisecond {
+			t.Errorf("Second fetch took %s, want it to skip the token", time.Since(start))
+		}
+	}
+}
+
+func TestClientCacheNotBlockedByToken(t *testing.T) {
+	f := newFakeIMDS()
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	// With a minute TTL every request needs a new token.
+	c := NewClient(WithBaseURL(srv.URL), WithTokenTTL(time.Minute))
+	if _, err := c.Document(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	hang := make(chan struct{})
+	f.mu.Lock()
+	f.hangToken = hang
+	f.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Signature(context.Background())
+	}()
+	for {
+		c.mu.Lock()
+		inFlight := c.tokenFetch != nil
+		c.mu.Unlock()
+		if inFlight {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	start := time.Now()
+	if _, err := c.Document(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("Cached read took %s while a token was requested", d)
+	}
+
+	// Callers waiting on the token can give up.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.Get(ctx, PKCS7Path); err == nil {
+		t.Error("want error waiting on a token past the deadline")
+	}
+	close(hang)
+	<-done
+}
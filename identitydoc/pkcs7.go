@@ -0,0 +1,308 @@
+package identitydoc
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// ErrInvalidPKCS7 is returned when a PKCS7 signature can't be parsed, or is of
+// an unsupported form.
+var ErrInvalidPKCS7 = errors.New("The provided PKCS7 signature is malformed or unsupported")
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+// The CMS structures we need, from RFC 5652. Certificates and CRLs are
+// ignored, the signature is only ever checked against our own certificates.
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []algorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    algorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm algorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// decodePKCS7 accepts a PKCS7 signature as PEM, as the bare base64 returned by
+// the metadata server, or as DER.
+func decodePKCS7(b []byte) ([]byte, error) {
+	// Base64 and PEM are at most about twice the size of the DER.
+	if len(b) > 2*maxPKCS7Size {
+		return nil, ErrInvalidPKCS7
+	}
+	if p, _ := pem.Decode(b); p != nil {
+		return p.Bytes, nil
+	}
+	if len(b) > 0 && b[0] == 0x30 {
+		return b, nil
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(b)), ""))
+	if err != nil {
+		return nil, ErrInvalidPKCS7
+	}
+	return der, nil
+}
+
+// parsePKCS7 parses a SignedData envelope, returning the signed content and
+// it's signer.
+func parsePKCS7(der []byte) ([]byte, *signerInfo, error) {
+	var ci contentInfo
+	if rest, err := asn1.Unmarshal(der, &ci); err != nil || len(rest) != 0 {
+		return nil, nil, ErrInvalidPKCS7
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, nil, ErrInvalidPKCS7
+	}
+	var sd signedData
+	// Explicitly tagged raw values hold the tagged element, the content is
+	// inside it.
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, nil, ErrInvalidPKCS7
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidData) || len(sd.SignerInfos) != 1 {
+		return nil, nil, ErrInvalidPKCS7
+	}
+	var content []byte
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent.Bytes, &content); err != nil {
+		// Detached signatures aren't supported, we need the document.
+		return nil, nil, ErrInvalidPKCS7
+	}
+	return content, &sd.SignerInfos[0], nil
+}
+
+func hashFor(oid asn1.ObjectIdentifier) (crypto.Hash, bool) {
+	switch {
+	case oid.Equal(oidSHA1):
+		return crypto.SHA1, true
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, true
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, true
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, true
+	}
+	return 0, false
+}
+
+// signedBytes returns the bytes the signer's signature is over, checking the
+// signed attributes against the content if there are any.
+func (si *signerInfo) signedBytes(h crypto.Hash, content []byte) ([]byte, error) {
+	if len(si.SignedAttrs.FullBytes) == 0 {
+		return content, nil
+	}
+
+	// The signature is over the attributes' DER encoding as a SET, not with
+	// the implicit tag they're stored with.
+	signed := append([]byte{}, si.SignedAttrs.FullBytes...)
+	signed[0] = 0x31
+
+	var attrs []attribute
+	if rest, err := asn1.UnmarshalWithParams(signed, &attrs, "set"); err != nil || len(rest) != 0 {
+		return nil, ErrInvalidPKCS7
+	}
+	var digest, contentType []byte
+	for _, a := range attrs {
+		switch {
+		case a.Type.Equal(oidMessageDigest):
+			digest = a.Values.Bytes
+		case a.Type.Equal(oidContentType):
+			contentType = a.Values.Bytes
+		}
+	}
+	var (
+		md []byte
+		ct asn1.ObjectIdentifier
+	)
+	if _, err := asn1.Unmarshal(digest, &md); err != nil {
+		return nil, ErrInvalidPKCS7
+	}
+	if _, err := asn1.Unmarshal(contentType, &ct); err != nil || !ct.Equal(oidData) {
+		return nil, ErrInvalidPKCS7
+	}
+	hh := h.New()
+	hh.Write(content)
+	if !bytes.Equal(hh.Sum(nil), md) {
+		return nil, ErrInvalidDocument
+	}
+	return signed, nil
+}
+
+// checkPKCS7Signature checks the signer's signature over signed with cert's
+// key.
+func checkPKCS7Signature(cert *x509.Certificate, h crypto.Hash, signed, sig []byte) error {
+	hh := h.New()
+	hh.Write(signed)
+	digest := hh.Sum(nil)
+
+	if pub, ok := cert.PublicKey.(*rsa.PublicKey); ok {
+		return rsa.VerifyPKCS1v15(pub, h, digest, sig)
+	}
+
+	// DSA and ECDSA signatures are both a DER encoded pair of integers.
+	var rs struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(sig, &rs); err != nil {
+		return ErrInvalidDocument
+	}
+	var ok bool
+	switch pub := cert.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		ok = ecdsa.Verify(pub, digest, rs.R, rs.S)
+	case *dsa.PublicKey:
+		// The original /pkcs7 endpoint is signed with DSA, which x509 no
+		// longer verifies. DSA signs the leftmost bits of the digest, up to
+		// the size of Q.
+		if n := pub.Q.BitLen() / 8; len(digest) > n {
+			digest = digest[:n]
+		}
+		ok = dsa.Verify(pub, digest, rs.R, rs.S)
+	default:
+		return ErrInvalidPKCS7
+	}
+	if !ok {
+		return ErrInvalidDocument
+	}
+	return nil
+}
+
+// checkPKCS7 verifies the PKCS7 envelope against the region's certificates
+// for the kind of signature, returning the signed content.
+func (v *Verifier) checkPKCS7(kind SignatureKind, region string, der []byte) ([]byte, error) {
+	certs, err := v.forRegion(kind, region)
+	if err != nil {
+		return nil, err
+	}
+	content, si, err := parsePKCS7(der)
+	if err != nil {
+		return nil, err
+	}
+	h, ok := hashFor(si.DigestAlgorithm.Algorithm)
+	if !ok || !h.Available() {
+		return nil, ErrInvalidPKCS7
+	}
+	signed, err := si.signedBytes(h, content)
+	if err != nil {
+		return nil, err
+	}
+	for _, cert := range certs {
+		if checkPKCS7Signature(cert, h, signed, si.Signature) == nil {
+			return content, nil
+		}
+	}
+	return nil, ErrInvalidDocument
+}
+
+// verifyPKCS7 verifies a PKCS7 signature of the given kind, returning the
+// document embedded in it.
+func (v *Verifier) verifyPKCS7(kind SignatureKind, region string, pkcs7 []byte) (*InstanceIdentityDocument, error) {
+	// Don't parse anything for regions we can't verify.
+	if _, err := v.forRegion(kind, region); err != nil {
+		return nil, err
+	}
+	der, err := decodePKCS7(pkcs7)
+	if err != nil {
+		return nil, err
+	}
+	if der, err = berToDER(der); err != nil {
+		return nil, ErrInvalidPKCS7
+	}
+	content, err := v.checkPKCS7(kind, region, der)
+	if err != nil {
+		return nil, err
+	}
+
+	iid := &InstanceIdentityDocument{
+		Doc:      content,
+		PKCS7:    der,
+		Kind:     kind,
+		verifier: v,
+	}
+	if err := json.Unmarshal(content, iid); err != nil {
+		return nil, ErrInvalidDocument
+	}
+	if iid.Region != region {
+		return nil, ErrRegionMismatch
+	}
+	return iid, nil
+}
+
+// VerifyPKCS7 is as the package level function, using the verifier's
+// certificates.
+func (v *Verifier) VerifyPKCS7(region string, pkcs7 []byte) (*InstanceIdentityDocument, error) {
+	return v.verifyPKCS7(PKCS7Signature, region, pkcs7)
+}
+
+// VerifyRSA2048 is as the package level function, using the verifier's
+// certificates.
+func (v *Verifier) VerifyRSA2048(region string, rsa2048 []byte) (*InstanceIdentityDocument, error) {
+	return v.verifyPKCS7(RSA2048Signature, region, rsa2048)
+}
+
+// VerifyPKCS7 verifies a PKCS7 signed identity document against
+// DefaultVerifier's PKCS7Signature certificates for the given region,
+// returning the document embedded in it. The signature is as returned from:
+// http://169.254.169.254/latest/dynamic/instance-identity/pkcs7
+// and can also be PEM or DER encoded. The errors are as for
+// VerifyDocumentAndSignature, and ErrInvalidPKCS7 if the signature can't be
+// parsed.
+func VerifyPKCS7(region string, pkcs7 []byte) (*InstanceIdentityDocument, error) {
+	return DefaultVerifier.VerifyPKCS7(region, pkcs7)
+}
+
+// VerifyRSA2048 is as VerifyPKCS7, for the signature returned from:
+// http://169.254.169.254/latest/dynamic/instance-identity/rsa2048
+// It's verified against DefaultVerifier's RSA2048Signature certificates,
+// which AWS publishes per region. None are built in.
+func VerifyRSA2048(region string, rsa2048 []byte) (*InstanceIdentityDocument, error) {
+	return DefaultVerifier.VerifyRSA2048(region, rsa2048)
+}
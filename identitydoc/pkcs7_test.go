@@ -0,0 +1,122 @@
+package identitydoc_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/lstoll/grpce/identitydoc"
+	"github.com/lstoll/grpce/identitydoc/identitydoctest"
+)
+
+func TestVerifyPKCS7(t *testing.T) {
+	s := identitydoctest.NewSigner()
+	v := identitydoc.NewVerifier()
+	v.Add(identitydoc.RSA2048Signature, "us-east-1", s.Certificate)
+	doc := []byte(identitydoctest.AWSDocument)
+
+	for _, omitAttrs := range []bool{false, true} {
+		s.OmitSignedAttributes = omitAttrs
+		der := s.SignPKCS7DER(doc)
+		b64 := base64.StdEncoding.EncodeToString(der)
+		for name, enc := range map[string][]byte{
+			"der": der,
+			// The metadata server wraps it's base64 without PEM armour.
+			"base64": []byte(strings.Join(splitEvery(b64, 64), "\n")),
+			"pem":    pem.EncodeToMemory(&pem.Block{Type: "PKCS7", Bytes: der}),
+		} {
+			iid, err := v.VerifyRSA2048("us-east-1", enc)
+			if err != nil {
+				t.Errorf("omit attrs %v, %s: %v", omitAttrs, name, err)
+				continue
+			}
+			if iid.InstanceID != "i-1ddaabe5" || !bytes.Equal(iid.Doc, doc) {
+				t.Errorf("omit attrs %v, %s: unexpected document %+v", omitAttrs, name, iid)
+			}
+		}
+	}
+	s.OmitSignedAttributes = false
+
+	der := s.SignPKCS7DER(doc)
+	if _, err := v.VerifyRSA2048("us-west-2", der); err != identitydoc.ErrUnknownRegion {
+		t.Errorf("want ErrUnknownRegion, got %v", err)
+	}
+	v.Add(identitydoc.RSA2048Signature, "us-west-2", s.Certificate)
+	if _, err := v.VerifyRSA2048("us-west-2", der); err != identitydoc.ErrRegionMismatch {
+		t.Errorf("want ErrRegionMismatch, got %v", err)
+	}
+
+	other := identitydoctest.NewSigner()
+	if _, err := v.VerifyRSA2048("us-east-1", other.SignPKCS7DER(doc)); err != identitydoc.ErrInvalidDocument {
+		t.Errorf("want ErrInvalidDocument for another signer, got %v", err)
+	}
+
+	// Swap the content for another of the same length.
+	tampered := bytes.Replace(der, []byte("i-1ddaabe5"), []byte("i-00000000"), 1)
+	if _, err := v.VerifyRSA2048("us-east-1", tampered); err != identitydoc.ErrInvalidDocument {
+		t.Errorf("want ErrInvalidDocument for tampered content, got %v", err)
+	}
+
+	if _, err := v.VerifyRSA2048("us-east-1", []byte("junk")); err != identitydoc.ErrInvalidPKCS7 {
+		t.Errorf("want ErrInvalidPKCS7, got %v", err)
+	}
+	// Nothing is parsed for a region that can't be verified.
+	if _, err := v.VerifyRSA2048("eu-west-1", []byte("junk")); err != identitydoc.ErrUnknownRegion {
+		t.Errorf("want ErrUnknownRegion before parsing, got %v", err)
+	}
+
+	// Each kind of signature only uses it's own certificates.
+	v.Add(identitydoc.PKCS7Signature, "eu-west-1", s.Certificate)
+	if _, err := v.VerifyRSA2048("eu-west-1", der); err != identitydoc.ErrUnknownRegion {
+		t.Errorf("want ErrUnknownRegion without RSA-2048 certificates, got %v", err)
+	}
+	if _, err := v.VerifyPKCS7("us-east-1", der); err != identitydoc.ErrUnknownRegion {
+		t.Errorf("want ErrUnknownRegion without PKCS7 certificates, got %v", err)
+	}
+}
+
+func TestVerifyAWSPKCS7(t *testing.T) {
+	doc, err := identitydoc.VerifyPKCS7("us-east-1", []byte(identitydoctest.AWSPKCS7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.InstanceID != "i-f79fe56c" || doc.AccountID != "121659014334" || doc.PrivateIP != "172.30.0.252" {
+		t.Errorf("Unexpected document %+v", doc)
+	}
+	if doc.Kind != identitydoc.PKCS7Signature {
+		t.Errorf("want kind %v, got %v", identitydoc.PKCS7Signature, doc.Kind)
+	}
+	if err := doc.CheckSignature(); err != nil {
+		t.Errorf("CheckSignature: %v", err)
+	}
+
+	// The raw signature certificate doesn't verify it.
+	if _, err := identitydoc.VerifyRSA2048("us-east-1", []byte(identitydoctest.AWSPKCS7)); err != identitydoc.ErrUnknownRegion {
+		t.Errorf("want ErrUnknownRegion for RSA-2048, got %v", err)
+	}
+
+	// Tamper with the DSA signature's s value.
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(identitydoctest.AWSPKCS7), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := bytes.Index(der, []byte{0x02, 0x14, 0x3a, 0x3b})
+	if i < 0 {
+		t.Fatal("Signature not found in fixture")
+	}
+	der[i+2] ^= 0xff
+	if _, err := identitydoc.VerifyPKCS7("us-east-1", der); err != identitydoc.ErrInvalidDocument {
+		t.Errorf("want ErrInvalidDocument for a tampered DSA signature, got %v", err)
+	}
+}
+
+func splitEvery(s string, n int) []string {
+	var ret []string
+	for len(s) > n {
+		ret = append(ret, s[:n])
+		s = s[n:]
+	}
+	return append(ret, s)
+}
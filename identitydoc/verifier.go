@@ -0,0 +1,230 @@
+package identitydoc
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRegionMismatch is returned when the document is for a different region to
+// the one it's being verified for.
+var ErrRegionMismatch = errors.New("The provided identity document is for a different region")
+
+// ErrCertificateExpired is returned when all of a region's certificates are
+// outside their validity period.
+var ErrCertificateExpired = errors.New("No certificate for the provided region is currently valid")
+
+// Partitions regions are grouped in to. Each has it's own signing
+// certificates.
+const (
+	PartitionAWS      = "aws"
+	PartitionAWSCN    = "aws-cn"
+	PartitionAWSUSGov = "aws-us-gov"
+)
+
+// Partition returns the partition a region is in.
+func Partition(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return PartitionAWSCN
+	case strings.HasPrefix(region, "us-gov-"):
+		return PartitionAWSUSGov
+	default:
+		return PartitionAWS
+	}
+}
+
+// SignatureKind identifies which of the metadata server's signatures a
+// certificate is for. AWS signs each with a different key, so each has it's
+// own certificates.
+type SignatureKind int
+
+const (
+	// RawSignature is the RSA signature from the signature endpoint, verified
+	// with VerifyDocumentAndSignature.
+	RawSignature SignatureKind = iota
+	// PKCS7Signature is the DSA signed PKCS7 from the pkcs7 endpoint,
+	// verified with VerifyPKCS7.
+	PKCS7Signature
+	// RSA2048Signature is the RSA signed PKCS7 from the rsa2048 endpoint,
+	// verified with VerifyRSA2048.
+	RSA2048Signature
+)
+
+func (k SignatureKind) String() string {
+	switch k {
+	case RawSignature:
+		return "signature"
+	case PKCS7Signature:
+		return "pkcs7"
+	case RSA2048Signature:
+		return "rsa2048"
+	}
+	return "SignatureKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// SignatureKinds are all the kinds of signature.
+var SignatureKinds = []SignatureKind{RawSignature, PKCS7Signature, RSA2048Signature}
+
+// certKey is a region or partition's certificates for a kind of signature.
+type certKey struct {
+	kind SignatureKind
+	name string
+}
+
+// Verifier verifies identity documents against a set of trusted certificates,
+// by kind of signature and region. Regions without their own certificates
+// fall back to those of their partition. It is safe for concurrent use.
+type Verifier struct {
+	mu          sync.RWMutex
+	byRegion    map[certKey][]*x509.Certificate
+	byPartition map[certKey][]*x509.Certificate
+	now         func() time.Time
+}
+
+// NewVerifier returns a Verifier that trusts no certificates. Add some with
+// Add, Set or SetPartition. In tests, identitydoctest can generate one.
+func NewVerifier() *Verifier {
+	return &Verifier{
+		byRegion:    map[certKey][]*x509.Certificate{},
+		byPartition: map[certKey][]*x509.Certificate{},
+		now:         time.Now,
+	}
+}
+
+// DefaultVerifier is used by the package level functions. It starts with AWS's
+// certificates for the raw and PKCS7 signatures of the regions signed with
+// it's generic keys. Like any others, they are only trusted within their
+// validity period, the raw signature certificates until 2029. Newer regions
+// have their own certificates, and the RSA-2048 signature has per-region
+// certificates, which need to be added.
+var DefaultVerifier = NewVerifier()
+
+// AddCertificate adds a certificate for the kind of signature in the region
+// to DefaultVerifier.
+func AddCertificate(kind SignatureKind, region string, cert *x509.Certificate) {
+	DefaultVerifier.Add(kind, region, cert)
+}
+
+// SetCertificates replaces the certificates for the kind of signature in the
+// region in DefaultVerifier.
+func SetCertificates(kind SignatureKind, region string, certs ...*x509.Certificate) {
+	DefaultVerifier.Set(kind, region, certs...)
+}
+
+// Add adds a certificate for the kind of signature in the region. Documents
+// are accepted if they verify against any of the region's valid certificates,
+// so during a rollover both can be added.
+func (v *Verifier) Add(kind SignatureKind, region string, cert *x509.Certificate) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	k := certKey{kind, region}
+	v.byRegion[k] = append(v.byRegion[k], cert)
+}
+
+// Set replaces the certificates for the kind of signature in the region. With
+// no certificates the region's signatures are no longer accepted, unless it's
+// partition has certificates.
+func (v *Verifier) Set(kind SignatureKind, region string, certs ...*x509.Certificate) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	k := certKey{kind, region}
+	if len(certs) == 0 {
+		delete(v.byRegion, k)
+		return
+	}
+	v.byRegion[k] = append([]*x509.Certificate{}, certs...)
+}
+
+// SetPartition replaces the certificates for the kind of signature used for
+// regions in the partition that have none of their own.
+func (v *Verifier) SetPartition(kind SignatureKind, partition string, certs ...*x509.Certificate) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	k := certKey{kind, partition}
+	if len(certs) == 0 {
+		delete(v.byPartition, k)
+		return
+	}
+	v.byPartition[k] = append([]*x509.Certificate{}, certs...)
+}
+
+// SetClock overrides the time validity periods are checked against.
+func (v *Verifier) SetClock(now func() time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.now = now
+}
+
+// forRegion returns the certificates for the kind of signature in the region
+// that are currently valid.
+func (v *Verifier) forRegion(kind SignatureKind, region string) ([]*x509.Certificate, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	certs := v.byRegion[certKey{kind, region}]
+	if len(certs) == 0 {
+		certs = v.byPartition[certKey{kind, Partition(region)}]
+	}
+	if len(certs) == 0 {
+		return nil, ErrUnknownRegion
+	}
+	now := v.now()
+	var valid []*x509.Certificate
+	for _, cert := range certs {
+		if !now.Before(cert.NotBefore) && !now.After(cert.NotAfter) {
+			valid = append(valid, cert)
+		}
+	}
+	if len(valid) == 0 {
+		return nil, ErrCertificateExpired
+	}
+	return valid, nil
+}
+
+// check verifies the document's raw signature against the region's
+// certificates.
+func (v *Verifier) check(region string, d *InstanceIdentityDocument) error {
+	certs, err := v.forRegion(RawSignature, region)
+	if err != nil {
+		return err
+	}
+	for _, cert := range certs {
+		if cert.CheckSignature(x509.SHA256WithRSA, d.Doc, d.Sig) == nil {
+			return nil
+		}
+	}
+	return ErrInvalidDocument
+}
+
+// VerifyDocumentAndSignature is as the package level function, using the
+// verifier's certificates.
+func (v *Verifier) VerifyDocumentAndSignature(region string, document, signature []byte) (*InstanceIdentityDocument, error) {
+	if _, err := v.forRegion(RawSignature, region); err != nil {
+		return nil, err
+	}
+	rawSig, err := base64.StdEncoding.DecodeString(string(signature))
+	if err != nil {
+		return nil, err
+	}
+
+	iid := &InstanceIdentityDocument{
+		Doc:      document,
+		Sig:      rawSig,
+		verifier: v,
+	}
+	if err := json.Unmarshal(document, iid); err != nil {
+		return nil, ErrInvalidDocument
+	}
+	if iid.Region != region {
+		return nil, ErrRegionMismatch
+	}
+	if err := v.check(region, iid); err != nil {
+		return nil, err
+	}
+	return iid, nil
+}
@@ -0,0 +1,73 @@
+package identitydoc
+
+import (
+	"testing"
+	"time"
+)
+
+// validAt is while the built in AWS certificates are valid.
+var validAt = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestVerifier(t *testing.T) {
+	v := NewVerifier()
+	v.SetClock(func() time.Time { return validAt })
+	awsCert := DefaultVerifier.byRegion[certKey{RawSignature, "us-east-1"}][0]
+
+	if _, err := v.VerifyDocumentAndSignature("us-east-1", []byte(testDoc), []byte(testSig)); err != ErrUnknownRegion {
+		t.Errorf("want ErrUnknownRegion with no certificates, got %v", err)
+	}
+
+	v.SetPartition(RawSignature, PartitionAWS, awsCert)
+	if _, err := v.VerifyDocumentAndSignature("us-east-1", []byte(testDoc), []byte(testSig)); err != nil {
+		t.Errorf("want partition certificate used, got %v", err)
+	}
+	if _, err := v.VerifyDocumentAndSignature("cn-north-1", []byte(testDoc), []byte(testSig)); err != ErrUnknownRegion {
+		t.Errorf("want ErrUnknownRegion for another partition, got %v", err)
+	}
+	if _, err := v.VerifyDocumentAndSignature("us-west-2", []byte(testDoc), []byte(testSig)); err != ErrRegionMismatch {
+		t.Errorf("want ErrRegionMismatch for a document from another region, got %v", err)
+	}
+
+	// Certificates are only used for their kind of signature.
+	pv := NewVerifier()
+	pv.SetPartition(PKCS7Signature, PartitionAWS, awsCert)
+	pv.SetPartition(RSA2048Signature, PartitionAWS, awsCert)
+	if _, err := pv.VerifyDocumentAndSignature("us-east-1", []byte(testDoc), []byte(testSig)); err != ErrUnknownRegion {
+		t.Errorf("want ErrUnknownRegion without raw signature certificates, got %v", err)
+	}
+
+	// A region's own certificates override the partition's.
+	v.Set(RawSignature, "us-east-1", awsCert)
+	other := *awsCert
+	other.PublicKey = nil
+	v.Add(RawSignature, "us-east-1", &other)
+	if _, err := v.VerifyDocumentAndSignature("us-east-1", []byte(testDoc), []byte(testSig)); err != nil {
+		t.Errorf("want any of the region's certificates accepted, got %v", err)
+	}
+	v.Set(RawSignature, "us-east-1", &other)
+	if _, err := v.VerifyDocumentAndSignature("us-east-1", []byte(testDoc), []byte(testSig)); err != ErrInvalidDocument {
+		t.Errorf("want ErrInvalidDocument with an overridden certificate, got %v", err)
+	}
+	v.Set(RawSignature, "us-east-1")
+
+	// The built in certificate is only trusted within it's validity period.
+	for _, now := range []time.Time{awsCert.NotBefore.Add(-time.Hour), awsCert.NotAfter.Add(time.Hour)} {
+		v.SetClock(func() time.Time { return now })
+		if _, err := v.VerifyDocumentAndSignature("us-east-1", []byte(testDoc), []byte(testSig)); err != ErrCertificateExpired {
+			t.Errorf("at %s: want ErrCertificateExpired, got %v", now, err)
+		}
+	}
+}
+
+func TestPartition(t *testing.T) {
+	for region, want := range map[string]string{
+		"us-east-1":      PartitionAWS,
+		"ap-east-1":      PartitionAWS,
+		"cn-northwest-1": PartitionAWSCN,
+		"us-gov-west-1":  PartitionAWSUSGov,
+	} {
+		if got := Partition(region); got != want {
+			t.Errorf("%s: want partition %s, got %s", region, want, got)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package kv
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// tmpPrefix marks in progress writes, which are ignored when listing.
+const tmpPrefix = ".kv-tmp-"
+
+// Dir is a Store backed by a directory on the local filesystem, with one file
+// per key. Keys containing '/' are stored in subdirectories. Writes are made
+// atomically by renaming a temporary file in to place. ETags are the MD5 of
+// the file's contents, like S3's for simple uploads.
+//
+// Preconditions are only enforced between users of the same Dir, not between
+// processes sharing the directory.
+type Dir struct {
+	root string
+	mu   sync.Mutex
+}
+
+var _ Store = (*Dir)(nil)
+
+// NewDir returns a Store rooted at dir, creating it if needed.
+func NewDir(dir string) (*Dir, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Dir{root: dir}, nil
+}
+
+// path returns the file for key, refusing keys that would escape the root.
+func (d *Dir) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") {
+		return "", fmt.Errorf("kv: invalid key %q", key)
+	}
+	for _, el := range strings.Split(key, "/") {
+		if el == "" || el == "." || el == ".." || strings.HasPrefix(el, tmpPrefix) {
+			return "", fmt.Errorf("kv: invalid key %q", key)
+		}
+	}
+	return filepath.Join(d.root, filepath.FromSlash(key)), nil
+}
+
+// Get implements Store.
+func (d *Dir) Get(ctx context.Context, key string) (*Object, error) {
+	p, err := d.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return d.read(key, p)
+}
+
+func (d *Dir) read(key, p string) (*Object, error) {
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return nil, ErrNotFound
+	}
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return &Object{Key: key, Value: b, ETag: md5ETag(b), LastModified: fi.ModTime()}, nil
+}
+
+// checkPrecondition returns ErrPreconditionFailed if the object at p doesn't
+// satisfy pre. d.mu must be held.
+func (d *Dir) checkPrecondition(key, p string, pre Precondition) error {
+	if pre == (Precondition{}) {
+		return nil
+	}
+	o, err := d.read(key, p)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+	exists := err == nil
+	if pre.IfNoneMatch == "*" && exists {
+		return ErrPreconditionFailed
+	}
+	if pre.IfMatch != "" && (!exists || o.ETag != pre.IfMatch) {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// Put implements Store.
+func (d *Dir) Put(ctx context.Context, key string, value []byte, pre Precondition) (string, error) {
+	p, err := d.path(key)
+	if err != nil {
+		return "", err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.checkPrecondition(key, p, pre); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(p), tmpPrefix)
+	if err != nil {
+		return "", err
+	}
+	_, err = tmp.Write(value)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), p)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return md5ETag(value), nil
+}
+
+// Delete implements Store.
+func (d *Dir) Delete(ctx context.Context, key string, pre Precondition) error {
+	p, err := d.path(key)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.checkPrecondition(key, p, pre); err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List implements Store.
+func (d *Dir) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var ret []ObjectInfo
+	err := filepath.Walk(d.root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Removed while we were walking.
+				return nil
+			}
+			return err
+		}
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), tmpPrefix) {
+			return nil
+		}
+		rel, err := filepath.Rel(d.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		b, err := ioutil.ReadFile(p)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ret = append(ret, ObjectInfo{
+			Key:          key,
+			ETag:         md5ETag(b),
+			Size:         int64(len(b)),
+			LastModified: fi.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Key < ret[j].Key })
+	return ret, nil
+}
+
+func md5ETag(b []byte) string {
+	h := md5.Sum(b)
+	return `"` + hex.EncodeToString(h[:]) + `"`
+}
@@ -0,0 +1,47 @@
+package kv
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDir(t *testing.T) {
+	root, err := ioutil.TempDir("", "kvdir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	d, err := NewDir(filepath.Join(root, "store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, d)
+
+	ctx := context.Background()
+	for _, k := range []string{"../escape", "a/../../b", "/abs", "a//b", "dir/"} {
+		if _, err := d.Put(ctx, k, []byte("x"), Precondition{}); err == nil {
+			t.Errorf("want error writing invalid key %q", k)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "escape")); !os.IsNotExist(err) {
+		t.Error("Write escaped the store's root")
+	}
+
+	// Stray temp files from an interrupted write aren't listed.
+	if err := ioutil.WriteFile(filepath.Join(root, "store", "svc", tmpPrefix+"123"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := d.List(ctx, "svc/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range infos {
+		if filepath.Base(i.Key) == tmpPrefix+"123" {
+			t.Error("Temp file was listed")
+		}
+	}
+}
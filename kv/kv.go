@@ -0,0 +1,61 @@
+// Package kv defines a simple key/value store abstraction, modelled on the
+// subset of S3 used for service discovery, along with implementations of it.
+//
+// Every stored object has an ETag that changes whenever it's value does.
+// Writes can be made conditional on the ETag, allowing optimistic concurrency
+// control.
+package kv
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when the requested key does not exist.
+var ErrNotFound = errors.New("kv: key not found")
+
+// ErrPreconditionFailed is returned when a conditional write's precondition
+// did not hold.
+var ErrPreconditionFailed = errors.New("kv: precondition failed")
+
+// Object is a value stored in the KV store.
+type Object struct {
+	Key          string
+	Value        []byte
+	ETag         string
+	LastModified time.Time
+}
+
+// ObjectInfo describes an object without it's value, as returned by List.
+type ObjectInfo struct {
+	Key          string
+	ETag         string
+	Size         int64
+	LastModified time.Time
+}
+
+// Precondition restricts a write to the current state of the object. The zero
+// value always allows the write.
+type Precondition struct {
+	// IfMatch only allows the write if the object's current ETag is this.
+	IfMatch string
+	// IfNoneMatch set to "*" only allows the write if the object does not
+	// exist.
+	IfNoneMatch string
+}
+
+// Store is a key/value store.
+type Store interface {
+	// Get returns the object for key, or ErrNotFound.
+	Get(ctx context.Context, key string) (*Object, error)
+	// Put stores value under key, returning the new ETag. If the precondition
+	// fails ErrPreconditionFailed is returned.
+	Put(ctx context.Context, key string, value []byte, pre Precondition) (etag string, err error)
+	// Delete removes key. Deleting a key that doesn't exist is not an error,
+	// unless there is an IfMatch precondition. If the precondition fails
+	// ErrPreconditionFailed is returned.
+	Delete(ctx context.Context, key string, pre Precondition) error
+	// List returns all objects with keys starting with prefix, sorted by key.
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
@@ -0,0 +1,202 @@
+package kv
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryOption configures a Memory store.
+type MemoryOption func(*Memory)
+
+// WithListDelay makes List return the store's contents as they were d ago,
+// simulating an eventually consistent listing.
+func WithListDelay(d time.Duration) MemoryOption {
+	return func(m *Memory) {
+		m.listDelay = d
+	}
+}
+
+// WithGetDelay makes Get return objects as they were d ago, simulating stale
+// reads after a write.
+func WithGetDelay(d time.Duration) MemoryOption {
+	return func(m *Memory) {
+		m.getDelay = d
+	}
+}
+
+// Memory is an in-memory Store, intended for tests and local development. ETags
+// are a counter incremented on every write. Reads can optionally be delayed to
+// simulate an eventually consistent store, preconditions are always checked
+// against the latest state.
+type Memory struct {
+	listDelay time.Duration
+	getDelay  time.Duration
+
+	mu      sync.Mutex
+	version int
+	// current is the latest state, base the state before the first event in
+	// log. Events are only kept for as long as a delayed read may need them.
+	current map[string]*Object
+	base    map[string]*Object
+	log     []memEvent
+}
+
+// memEvent is a write to the store. obj is nil for deletes.
+type memEvent struct {
+	at  time.Time
+	key string
+	obj *Object
+}
+
+var _ Store = (*Memory)(nil)
+
+// NewMemory returns an empty Memory store.
+func NewMemory(opts ...MemoryOption) *Memory {
+	m := &Memory{
+		current: map[string]*Object{},
+		base:    map[string]*Object{},
+	}
+	for _, o := range opts {
+		o(m)
+	}
+	return m
+}
+
+// Get implements Store.
+func (m *Memory) Get(ctx context.Context, key string) (*Object, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o, ok := m.stateAt(time.Now().Add(-m.getDelay))[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyObject(o), nil
+}
+
+// Put implements Store.
+func (m *Memory) Put(ctx context.Context, key string, value []byte, pre Precondition) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkPrecondition(key, pre); err != nil {
+		return "", err
+	}
+	m.version++
+	o := &Object{
+		Key:          key,
+		Value:        append([]byte{}, value...),
+		ETag:         `"` + strconv.Itoa(m.version) + `"`,
+		LastModified: time.Now(),
+	}
+	m.record(key, o)
+	return o.ETag, nil
+}
+
+// Delete implements Store.
+func (m *Memory) Delete(ctx context.Context, key string, pre Precondition) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkPrecondition(key, pre); err != nil {
+		return err
+	}
+	if _, ok := m.current[key]; ok {
+		m.record(key, nil)
+	}
+	return nil
+}
+
+// List implements Store.
+func (m *Memory) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ret []ObjectInfo
+	for k, o := range m.stateAt(time.Now().Add(-m.listDelay)) {
+		if strings.HasPrefix(k, prefix) {
+			ret = append(ret, ObjectInfo{
+				Key:          k,
+				ETag:         o.ETag,
+				Size:         int64(len(o.Value)),
+				LastModified: o.LastModified,
+			})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Key < ret[j].Key })
+	return ret, nil
+}
+
+func (m *Memory) checkPrecondition(key string, pre Precondition) error {
+	o, exists := m.current[key]
+	if pre.IfNoneMatch == "*" && exists {
+		return ErrPreconditionFailed
+	}
+	if pre.IfMatch != "" && (!exists || o.ETag != pre.IfMatch) {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// record applies a write, keeping it in the log if delayed reads may need it.
+// m.mu must be held.
+func (m *Memory) record(key string, o *Object) {
+	now := time.Now()
+	if o == nil {
+		delete(m.current, key)
+	} else {
+		m.current[key] = o
+	}
+	if m.listDelay == 0 && m.getDelay == 0 {
+		return
+	}
+	m.log = append(m.log, memEvent{at: now, key: key, obj: o})
+
+	// Fold events no read can see before any more in to the base.
+	horizon := m.listDelay
+	if m.getDelay > horizon {
+		horizon = m.getDelay
+	}
+	cutoff := now.Add(-horizon)
+	i := 0
+	for ; i < len(m.log) && m.log[i].at.Before(cutoff); i++ {
+		applyEvent(m.base, m.log[i])
+	}
+	m.log = m.log[i:]
+}
+
+// stateAt returns the contents of the store as of t. m.mu must be held.
+func (m *Memory) stateAt(t time.Time) map[string]*Object {
+	if len(m.log) == 0 {
+		return m.current
+	}
+	state := make(map[string]*Object, len(m.base))
+	for k, o := range m.base {
+		state[k] = o
+	}
+	for _, e := range m.log {
+		if e.at.After(t) {
+			break
+		}
+		applyEvent(state, e)
+	}
+	return state
+}
+
+func applyEvent(state map[string]*Object, e memEvent) {
+	if e.obj == nil {
+		delete(state, e.key)
+	} else {
+		state[e.key] = e.obj
+	}
+}
+
+func copyObject(o *Object) *Object {
+	c := *o
+	c.Value = append([]byte{}, o.Value...)
+	return &c
+}
@@ -0,0 +1,52 @@
+package kv
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	testStore(t, NewMemory())
+}
+
+func TestMemoryDelays(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(WithListDelay(50*time.Millisecond), WithGetDelay(20*time.Millisecond))
+
+	etag, err := m.Put(ctx, "svc/a", []byte("a"), Precondition{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Preconditions always see the latest write.
+	if _, err := m.Put(ctx, "svc/a", []byte("b"), Precondition{IfMatch: etag}); err != nil {
+		t.Errorf("Precondition did not see latest write: %v", err)
+	}
+
+	if infos, _ := m.List(ctx, "svc/"); len(infos) != 0 {
+		t.Error("New key was listed before the list delay")
+	}
+	if _, err := m.Get(ctx, "svc/a"); err != ErrNotFound {
+		t.Errorf("want ErrNotFound before the get delay, got %v", err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if o, err := m.Get(ctx, "svc/a"); err != nil || string(o.Value) != "b" {
+		t.Errorf("want latest value after the get delay, got %v %v", o, err)
+	}
+	if infos, _ := m.List(ctx, "svc/"); len(infos) != 0 {
+		t.Error("New key was listed before the list delay")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if infos, _ := m.List(ctx, "svc/"); len(infos) != 1 {
+		t.Errorf("want key listed after the list delay, got %v", infos)
+	}
+
+	if err := m.Delete(ctx, "svc/a", Precondition{}); err != nil {
+		t.Fatal(err)
+	}
+	if infos, _ := m.List(ctx, "svc/"); len(infos) != 1 {
+		t.Error("Deleted key was not listed during the list delay")
+	}
+}
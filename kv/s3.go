@@ -0,0 +1,271 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3Config configures an S3 store.
+type S3Config struct {
+	// Endpoint is the base URL of the S3 compatible service, for example
+	// https://s3.us-east-1.amazonaws.com or http://localhost:9000.
+	Endpoint string
+	// Region is used for request signing.
+	Region string
+	// Bucket objects are stored in.
+	Bucket string
+	// Prefix is prepended to every key, allowing multiple stores to share a
+	// bucket.
+	Prefix string
+	// VirtualHostedStyle addresses the bucket as a subdomain of the endpoint,
+	// rather than the first component of the path.
+	VirtualHostedStyle bool
+
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// HTTPClient is used to make requests. If nil, http.DefaultClient is
+	// used.
+	HTTPClient *http.Client
+}
+
+// S3 is a Store backed by an S3 compatible object store.
+type S3 struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+var _ Store = (*S3)(nil)
+
+// NewS3 returns a Store for the configured bucket.
+func NewS3(cfg S3Config) (*S3, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("kv: S3 bucket is required")
+	}
+	if cfg.Region == "" {
+		return nil, errors.New("kv: S3 region is required")
+	}
+	ep, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if ep.Scheme == "" || ep.Host == "" {
+		return nil, fmt.Errorf("kv: S3 endpoint %q must be an absolute URL", cfg.Endpoint)
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &S3{cfg: cfg, endpoint: ep, client: client}, nil
+}
+
+// S3Error is returned for unexpected responses from S3.
+type S3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *S3Error) Error() string {
+	return fmt.Sprintf("kv: S3 request failed with status %d: %s %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Get implements Store.
+func (s *S3) Get(ctx context.Context, key string) (*Object, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	lm, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &Object{
+		Key:          key,
+		Value:        b,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: lm,
+	}, nil
+}
+
+// Put implements Store.
+func (s *S3) Put(ctx context.Context, key string, value []byte, pre Precondition) (string, error) {
+	h := preconditionHeaders(pre)
+	h.Set("Content-Type", "application/octet-stream")
+	resp, err := s.do(ctx, http.MethodPut, key, nil, h, value)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		if err == ErrNotFound && pre.IfMatch != "" {
+			// S3 reports a conditional write to a missing key as not found.
+			return "", ErrPreconditionFailed
+		}
+		return "", err
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+// Delete implements Store.
+func (s *S3) Delete(ctx context.Context, key string, pre Precondition) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, preconditionHeaders(pre), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = checkResponse(resp)
+	if err == ErrNotFound {
+		if pre.IfMatch != "" {
+			// S3 reports a conditional write to a missing key as not found.
+			return ErrPreconditionFailed
+		}
+		return nil
+	}
+	return err
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		ETag         string    `xml:"ETag"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List implements Store. It follows continuation tokens until the full
+// listing has been retrieved.
+func (s *S3) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var (
+		ret   []ObjectInfo
+		token string
+	)
+	for {
+		q := url.Values{}
+		q.Set("list-type", "2")
+		q.Set("prefix", s.cfg.Prefix+prefix)
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+
+		resp, err := s.do(ctx, http.MethodGet, "", q, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var lbr listBucketResult
+		err = checkResponse(resp)
+		if err == nil {
+			err = xml.NewDecoder(resp.Body).Decode(&lbr)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range lbr.Contents {
+			ret = append(ret, ObjectInfo{
+				Key:          strings.TrimPrefix(c.Key, s.cfg.Prefix),
+				ETag:         c.ETag,
+				Size:         c.Size,
+				LastModified: c.LastModified,
+			})
+		}
+		if !lbr.IsTruncated || lbr.NextContinuationToken == "" {
+			return ret, nil
+		}
+		token = lbr.NextContinuationToken
+	}
+}
+
+// do makes a signed request for key. An empty key addresses the bucket.
+func (s *S3) do(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := *s.endpoint
+	path := strings.TrimSuffix(u.Path, "/")
+	if s.cfg.VirtualHostedStyle {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		path += "/"
+	} else {
+		path += "/" + s.cfg.Bucket + "/"
+	}
+	if key != "" {
+		path += s.cfg.Prefix + key
+	}
+	u.Path = path
+	u.RawPath = uriEncode(path, false)
+	u.RawQuery = ""
+
+	var rbody io.Reader
+	if body != nil {
+		rbody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, u.String(), rbody)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if query != nil {
+		// Encode the query the same way it is signed, url.Values uses '+'
+		// for spaces which S3 would treat as a literal '+'.
+		req.URL.RawQuery = canonicalQuery(query)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	payloadHash := emptyBodySHA256
+	if body != nil {
+		payloadHash = hexSHA256(body)
+	}
+	signV4(req, payloadHash, s.cfg.Region, "s3", s.cfg.AccessKeyID, s.cfg.SecretAccessKey, s.cfg.SessionToken, time.Now())
+
+	return s.client.Do(req)
+}
+
+func preconditionHeaders(pre Precondition) http.Header {
+	h := http.Header{}
+	if pre.IfMatch != "" {
+		h.Set("If-Match", pre.IfMatch)
+	}
+	if pre.IfNoneMatch != "" {
+		h.Set("If-None-Match", pre.IfNoneMatch)
+	}
+	return h
+}
+
+// checkResponse maps non 2xx responses to errors.
+func checkResponse(resp *http.Response) error {
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode == http.StatusPreconditionFailed, resp.StatusCode == http.StatusConflict:
+		return ErrPreconditionFailed
+	}
+	e := &S3Error{StatusCode: resp.StatusCode}
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	xml.Unmarshal(b, e)
+	return e
+}
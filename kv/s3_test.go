@@ -0,0 +1,137 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lstoll/grpce/kv/s3fake"
+)
+
+// signatureChecker verifies each request's signature by re-signing it, before
+// passing it on to the fake.
+type signatureChecker struct {
+	t    *testing.T
+	next http.Handler
+}
+
+func (s *signatureChecker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	date, _ := time.Parse(amzDateFormat, r.Header.Get("X-Amz-Date"))
+	check, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	for k, v := range r.Header {
+		check.Header[k] = v
+	}
+	check.Header.Del("Authorization")
+	signV4(check, hexSHA256(body), "us-east-1", "s3", "AKID", "secret", "", date)
+	if got, want := r.Header.Get("Authorization"), check.Header.Get("Authorization"); got != want {
+		s.t.Errorf("Bad signature for %s %s\nwant: %s\ngot:  %s", r.Method, r.URL, want, got)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	s.next.ServeHTTP(w, r)
+}
+
+func TestS3(t *testing.T) {
+	fake := s3fake.New(s3fake.WithBucket("bucket"), s3fake.WithMaxKeys(2), s3fake.WithAccessKeyID("AKID"))
+	ts := httptest.NewServer(&signatureChecker{t: t, next: fake})
+	defer ts.Close()
+
+	s, err := NewS3(S3Config{
+		Endpoint:        ts.URL,
+		Region:          "us-east-1",
+		Bucket:          "bucket",
+		Prefix:          "pfx/",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+}
+
+// testStore runs a Store implementation through the behaviour expected of
+// all of them.
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	if _, err := s.Get(ctx, "missing"); err != ErrNotFound {
+		t.Errorf("want ErrNotFound getting a missing key, got %v", err)
+	}
+	if err := s.Delete(ctx, "missing", Precondition{}); err != nil {
+		t.Errorf("want no error deleting a missing key, got %v", err)
+	}
+
+	etag, err := s.Put(ctx, "svc/a b+c", []byte("one"), Precondition{IfNoneMatch: "*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if etag == "" {
+		t.Error("Put returned an empty ETag")
+	}
+	if _, err := s.Put(ctx, "svc/a b+c", []byte("two"), Precondition{IfNoneMatch: "*"}); err != ErrPreconditionFailed {
+		t.Errorf("want ErrPreconditionFailed creating an existing key, got %v", err)
+	}
+
+	o, err := s.Get(ctx, "svc/a b+c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(o.Value) != "one" || o.ETag != etag || o.Key != "svc/a b+c" {
+		t.Errorf("Unexpected object %+v", o)
+	}
+
+	if _, err := s.Put(ctx, "svc/a b+c", []byte("two"), Precondition{IfMatch: `"wrong"`}); err != ErrPreconditionFailed {
+		t.Errorf("want ErrPreconditionFailed with a stale ETag, got %v", err)
+	}
+	etag2, err := s.Put(ctx, "svc/a b+c", []byte("two"), Precondition{IfMatch: etag})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if etag2 == etag {
+		t.Error("ETag did not change with the value")
+	}
+
+	for _, k := range []string{"svc/b", "svc/c", "svc/d", "other/a"} {
+		if _, err := s.Put(ctx, k, []byte(k), Precondition{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	infos, err := s.List(ctx, "svc/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, i := range infos {
+		keys = append(keys, i.Key)
+		if i.ETag == "" {
+			t.Errorf("Listing for %q has no ETag", i.Key)
+		}
+	}
+	if got, want := strings.Join(keys, ","), "svc/a b+c,svc/b,svc/c,svc/d"; got != want {
+		t.Errorf("want listing %q, got %q", want, got)
+	}
+
+	if _, err := s.Put(ctx, "missing", []byte("x"), Precondition{IfMatch: etag}); err != ErrPreconditionFailed {
+		t.Errorf("want ErrPreconditionFailed updating a missing key, got %v", err)
+	}
+	if err := s.Delete(ctx, "missing", Precondition{IfMatch: etag}); err != ErrPreconditionFailed {
+		t.Errorf("want ErrPreconditionFailed deleting a missing key with IfMatch, got %v", err)
+	}
+	if err := s.Delete(ctx, "svc/b", Precondition{IfMatch: `"wrong"`}); err != ErrPreconditionFailed {
+		t.Errorf("want ErrPreconditionFailed deleting with a stale ETag, got %v", err)
+	}
+	if err := s.Delete(ctx, "svc/b", Precondition{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, "svc/b"); err != ErrNotFound {
+		t.Errorf("want ErrNotFound after delete, got %v", err)
+	}
+}
@@ -0,0 +1,348 @@
+// Package s3fake implements an in-memory fake of the subset of the S3 REST API
+// used by the kv package, for integration testing without a network. It is an
+// http.Handler, intended to be served with httptest:
+//
+//	fake := s3fake.New(s3fake.WithBucket("bucket"))
+//	srv := httptest.NewServer(fake)
+//	defer srv.Close()
+//
+// Buckets are addressed path style, i.e http://host/bucket/key. Supported are
+// GetObject, PutObject and DeleteObject with If-Match and If-None-Match
+// conditions, and ListObjectsV2 with prefix, start-after and pagination.
+// Listings can optionally lag behind writes, like an eventually consistent
+// store. Request signatures are not verified, see WithAccessKeyID.
+package s3fake
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Option configures a Fake.
+type Option func(*Fake)
+
+// WithBucket creates a bucket.
+func WithBucket(name string) Option {
+	return func(f *Fake) {
+		f.buckets[name] = map[string]*object{}
+	}
+}
+
+// WithListLag delays new objects appearing in, and deleted objects
+// disappearing from, listings by d.
+func WithListLag(d time.Duration) Option {
+	return func(f *Fake) {
+		f.listLag = d
+	}
+}
+
+// WithMaxKeys sets the most keys returned in a single page of a listing, unless
+// the request asks for fewer. The default is 1000, like S3.
+func WithMaxKeys(n int) Option {
+	return func(f *Fake) {
+		f.maxKeys = n
+	}
+}
+
+// WithAccessKeyID makes requests fail with AccessDenied unless they are
+// signed with the given access key ID. Only the credential is checked, not the
+// signature itself.
+func WithAccessKeyID(id string) Option {
+	return func(f *Fake) {
+		f.accessKeyID = id
+	}
+}
+
+// Fake is a fake S3 server.
+type Fake struct {
+	listLag     time.Duration
+	maxKeys     int
+	accessKeyID string
+
+	mu      sync.Mutex
+	buckets map[string]map[string]*object
+}
+
+// object is a stored object. Deleted objects are kept as tombstones until they
+// stop being listed.
+type object struct {
+	data      []byte
+	etag      string
+	created   time.Time
+	modified  time.Time
+	deleted   bool
+	deletedAt time.Time
+}
+
+// New returns a Fake with no buckets.
+func New(opts ...Option) *Fake {
+	f := &Fake{
+		maxKeys: 1000,
+		buckets: map[string]map[string]*object{},
+	}
+	for _, o := range opts {
+		o(f)
+	}
+	return f
+}
+
+// CreateBucket adds a bucket, if it doesn't already exist.
+func (f *Fake) CreateBucket(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.buckets[name]; !ok {
+		f.buckets[name] = map[string]*object{}
+	}
+}
+
+type s3Error struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(&s3Error{Code: code, Message: msg})
+}
+
+func (f *Fake) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.accessKeyID != "" {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 ") || !strings.Contains(auth, "Credential="+f.accessKeyID+"/") {
+			writeError(w, http.StatusForbidden, "AccessDenied", "Access Denied")
+			return
+		}
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucket := parts[0]
+	key := ""
+	if len(parts) == 2 {
+		key = parts[1]
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	objects, ok := f.buckets[bucket]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		if r.URL.Query().Get("list-type") != "2" {
+			writeError(w, http.StatusNotImplemented, "NotImplemented", "Only ListObjectsV2 is supported")
+			return
+		}
+		f.list(w, r, bucket, objects)
+	case key == "":
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource")
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		f.get(w, r, objects, key)
+	case r.Method == http.MethodPut:
+		f.put(w, r, objects, key)
+	case r.Method == http.MethodDelete:
+		f.delete(w, r, objects, key)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource")
+	}
+}
+
+// live returns the object for key if it exists and isn't deleted.
+func live(objects map[string]*object, key string) (*object, bool) {
+	o, ok := objects[key]
+	if !ok || o.deleted {
+		return nil, false
+	}
+	return o, true
+}
+
+// checkWriteConditions writes an error response and returns false if the
+// request's conditions don't hold against the current object.
+func checkWriteConditions(w http.ResponseWriter, r *http.Request, o *object, exists bool) bool {
+	if im := r.Header.Get("If-Match"); im != "" && (!exists || im != o.etag) {
+		if !exists {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		} else {
+			writeError(w, http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+		}
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" && exists && (inm == "*" || inm == o.etag) {
+		writeError(w, http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+		return false
+	}
+	return true
+}
+
+func (f *Fake) get(w http.ResponseWriter, r *http.Request, objects map[string]*object, key string) {
+	o, ok := live(objects, key)
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+	if im := r.Header.Get("If-Match"); im != "" && im != o.etag {
+		writeError(w, http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+		return
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" && inm == o.etag {
+		w.Header().Set("ETag", o.etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", o.etag)
+	w.Header().Set("Last-Modified", o.modified.UTC().Format(http.TimeFormat))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(o.data)))
+	if r.Method == http.MethodGet {
+		w.Write(o.data)
+	}
+}
+
+func (f *Fake) put(w http.ResponseWriter, r *http.Request, objects map[string]*object, key string) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	curr, exists := live(objects, key)
+	if !checkWriteConditions(w, r, curr, exists) {
+		return
+	}
+
+	sum := md5.Sum(body)
+	o := &object{
+		data:     body,
+		etag:     `"` + hex.EncodeToString(sum[:]) + `"`,
+		modified: time.Now(),
+	}
+	o.created = o.modified
+	if exists {
+		// Overwriting an object doesn't change when it's listed from.
+		o.created = curr.created
+	}
+	objects[key] = o
+	w.Header().Set("ETag", o.etag)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (f *Fake) delete(w http.ResponseWriter, r *http.Request, objects map[string]*object, key string) {
+	curr, exists := live(objects, key)
+	if !checkWriteConditions(w, r, curr, exists) {
+		return
+	}
+	if exists {
+		curr.deleted = true
+		curr.deletedAt = time.Now()
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type listContents struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int    `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name       `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	KeyCount              int            `xml:"KeyCount"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	Contents              []listContents `xml:"Contents"`
+}
+
+func (f *Fake) list(w http.ResponseWriter, r *http.Request, bucket string, objects map[string]*object) {
+	q := r.URL.Query()
+	res := &listBucketResult{
+		Name:              bucket,
+		Prefix:            q.Get("prefix"),
+		StartAfter:        q.Get("start-after"),
+		MaxKeys:           f.maxKeys,
+		ContinuationToken: q.Get("continuation-token"),
+	}
+	if mk := q.Get("max-keys"); mk != "" {
+		n, err := strconv.Atoi(mk)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "InvalidArgument", "Invalid max-keys")
+			return
+		}
+		if n < res.MaxKeys {
+			res.MaxKeys = n
+		}
+	}
+	after := res.StartAfter
+	if res.ContinuationToken != "" {
+		b, err := base64.URLEncoding.DecodeString(res.ContinuationToken)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "InvalidArgument", "The continuation token provided is incorrect")
+			return
+		}
+		after = string(b)
+	}
+
+	now := time.Now()
+	var keys []string
+	for k, o := range objects {
+		if !strings.HasPrefix(k, res.Prefix) || k <= after {
+			continue
+		}
+		if o.deleted {
+			if now.Sub(o.deletedAt) >= f.listLag {
+				// Lagged long enough, the tombstone can go.
+				delete(objects, k)
+				continue
+			}
+		} else if now.Sub(o.created) < f.listLag {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	switch {
+	case res.MaxKeys == 0:
+		// A valid request, that only says whether there are any keys.
+		res.IsTruncated = len(keys) > 0
+		keys = nil
+	case len(keys) > res.MaxKeys:
+		keys = keys[:res.MaxKeys]
+		res.IsTruncated = true
+		res.NextContinuationToken = base64.URLEncoding.EncodeToString([]byte(keys[len(keys)-1]))
+	}
+	for _, k := range keys {
+		o := objects[k]
+		res.Contents = append(res.Contents, listContents{
+			Key:          k,
+			LastModified: o.modified.UTC().Format("2006-01-02T15:04:05.000Z"),
+			ETag:         o.etag,
+			Size:         len(o.data),
+			StorageClass: "STANDARD",
+		})
+	}
+	res.KeyCount = len(res.Contents)
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(res)
+}
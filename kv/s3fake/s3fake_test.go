@@ -0,0 +1,137 @@
+package s3fake
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func do(t *testing.T, method, url, body string, header map[string]string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func listKeys(t *testing.T, url string) []string {
+	t.Helper()
+	resp := do(t, http.MethodGet, url, "", nil)
+	defer resp.Body.Close()
+	var res listBucketResult
+	if err := xml.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, c := range res.Contents {
+		keys = append(keys, c.Key)
+	}
+	return keys
+}
+
+func TestListLag(t *testing.T) {
+	srv := httptest.NewServer(New(WithBucket("b"), WithListLag(30*time.Millisecond)))
+	defer srv.Close()
+
+	resp := do(t, http.MethodPut, srv.URL+"/b/svc/a", "a", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("want put to succeed, got %d", resp.StatusCode)
+	}
+
+	list := srv.URL + "/b?list-type=2&prefix=svc/"
+	if keys := listKeys(t, list); len(keys) != 0 {
+		t.Errorf("New object listed before the lag, got %v", keys)
+	}
+	resp = do(t, http.MethodGet, srv.URL+"/b/svc/a", "", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("want new object readable straight away, got %d", resp.StatusCode)
+	}
+
+	time.Sleep(35 * time.Millisecond)
+	if keys := listKeys(t, list); len(keys) != 1 {
+		t.Errorf("want object listed after the lag, got %v", keys)
+	}
+
+	resp = do(t, http.MethodDelete, srv.URL+"/b/svc/a", "", nil)
+	resp.Body.Close()
+	if keys := listKeys(t, list); len(keys) != 1 {
+		t.Errorf("want deleted object still listed during the lag, got %v", keys)
+	}
+	time.Sleep(35 * time.Millisecond)
+	if keys := listKeys(t, list); len(keys) != 0 {
+		t.Errorf("want deleted object gone after the lag, got %v", keys)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	srv := httptest.NewServer(New(WithBucket("b"), WithAccessKeyID("AKID")))
+	defer srv.Close()
+
+	auth := map[string]string{"Authorization": "AWS4-HMAC-SHA256 Credential=AKID/20190101/us-east-1/s3/aws4_request"}
+	for _, tc := range []struct {
+		method, path string
+		header       map[string]string
+		status       int
+		code         string
+	}{
+		{http.MethodGet, "/b/k", nil, http.StatusForbidden, "AccessDenied"},
+		{http.MethodGet, "/b/k", auth, http.StatusNotFound, "NoSuchKey"},
+		{http.MethodGet, "/other/k", auth, http.StatusNotFound, "NoSuchBucket"},
+	} {
+		resp := do(t, tc.method, srv.URL+tc.path, "", tc.header)
+		var e s3Error
+		xml.NewDecoder(resp.Body).Decode(&e)
+		resp.Body.Close()
+		if resp.StatusCode != tc.status || e.Code != tc.code {
+			t.Errorf("%s %s: want %d %s, got %d %s", tc.method, tc.path, tc.status, tc.code, resp.StatusCode, e.Code)
+		}
+	}
+}
+
+func TestListMaxKeysZero(t *testing.T) {
+	for _, tc := range []struct {
+		opts  []Option
+		query string
+	}{
+		{[]Option{WithBucket("b")}, "&max-keys=0"},
+		{[]Option{WithBucket("b"), WithMaxKeys(0)}, ""},
+	} {
+		srv := httptest.NewServer(New(tc.opts...))
+		list := func() listBucketResult {
+			t.Helper()
+			resp := do(t, http.MethodGet, srv.URL+"/b?list-type=2"+tc.query, "", nil)
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("want list to succeed, got %d", resp.StatusCode)
+			}
+			var res listBucketResult
+			if err := xml.NewDecoder(resp.Body).Decode(&res); err != nil {
+				t.Fatal(err)
+			}
+			return res
+		}
+
+		if res := list(); res.KeyCount != 0 || res.IsTruncated {
+			t.Errorf("want an empty untruncated page for an empty bucket, got %+v", res)
+		}
+		resp := do(t, http.MethodPut, srv.URL+"/b/k", "v", nil)
+		resp.Body.Close()
+		if res := list(); res.KeyCount != 0 || len(res.Contents) != 0 || !res.IsTruncated {
+			t.Errorf("want an empty truncated page, got %+v", res)
+		}
+		srv.Close()
+	}
+}
@@ -0,0 +1,131 @@
+package kvresolver
+
+import (
+	"time"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// Scheme is the default scheme Builders are registered under. Targets are
+// dialed as kv:///<target>, and the endpoint is what is passed to the poll
+// function.
+const Scheme = "kv"
+
+// Builder is a resolver.Builder that polls a function for the list of
+// addresses for a target.
+type Builder struct {
+	pollFunc     ViewPollFunc
+	pollInterval time.Duration
+	opts         *kvrOptions
+	shared       *sharedPollers
+}
+
+// NewBuilder returns a Builder that will poll pollFunc every pollInterval for
+// the addresses of each target it builds a resolver for.
+func NewBuilder(pollInterval time.Duration, pollFunc func(target string) ([]string, error), opts ...KVROption) *Builder {
+	return NewEndpointBuilder(pollInterval, addrPollFunc(pollFunc), opts...)
+}
+
+// NewEndpointBuilder returns a Builder that will poll pollFunc every
+// pollInterval for the endpoints of each target it builds a resolver for.
+// Each resolver.Address has the endpoint's ServerName set, and it's Metadata
+// is a *Endpoint. The pointer is stable for as long as the endpoint is
+// unchanged.
+func NewEndpointBuilder(pollInterval time.Duration, pollFunc EndpointPollFunc, opts ...KVROption) *Builder {
+	return NewContextBuilder(pollInterval, contextPollFunc(pollFunc), opts...)
+}
+
+// NewContextBuilder returns a Builder that will poll pollFunc every
+// pollInterval for the endpoints of each target it builds a resolver for. The
+// context passed to pollFunc is cancelled when the resolver is closed, or the
+// poll exceeds the WithPollTimeout timeout.
+func NewContextBuilder(pollInterval time.Duration, pollFunc ContextPollFunc, opts ...KVROption) *Builder {
+	return NewViewBuilder(pollInterval, viewPollFunc(pollFunc), opts...)
+}
+
+// NewViewBuilder returns a Builder that will poll pollFunc every pollInterval
+// for a versioned view of the endpoints of each target it builds a resolver
+// for. Views older than the last one applied are rejected, and counted in
+// "kvresolver.generation.rejected".
+func NewViewBuilder(pollInterval time.Duration, pollFunc ViewPollFunc, opts ...KVROption) *Builder {
+	kvo := &kvrOptions{scheme: Scheme}
+	for _, opt := range opts {
+		opt(kvo)
+	}
+
+	b := &Builder{
+		pollFunc:     pollFunc,
+		pollInterval: pollInterval,
+		opts:         kvo,
+	}
+	if kvo.sharedPolling {
+		b.shared = newSharedPollers()
+	}
+	return b
+}
+
+// Register creates a Builder and registers it with grpc. Like
+// resolver.Register, it should only be called at init time.
+func Register(pollInterval time.Duration, pollFunc func(target string) ([]string, error), opts ...KVROption) *Builder {
+	b := NewBuilder(pollInterval, pollFunc, opts...)
+	resolver.Register(b)
+	return b
+}
+
+// Build starts polling for the target's endpoint, returning a resolver that
+// pushes the results to cc.
+func (b *Builder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOption) (resolver.Resolver, error) {
+	serviceConfig := b.opts.serviceConfig
+	if opts.DisableServiceConfig {
+		serviceConfig = ""
+	}
+
+	// Balancers use the whole address as a map key, so keep handing them the
+	// same pointer until the endpoint changes.
+	curr := map[string]*Endpoint{}
+	h := newPollHandle(b.shared, target.Endpoint, b.pollInterval, b.pollFunc, b.opts, func(endpoints []Endpoint) {
+		state := resolver.State{
+			Addresses:     make([]resolver.Address, 0, len(endpoints)),
+			ServiceConfig: serviceConfig,
+		}
+		next := make(map[string]*Endpoint, len(endpoints))
+		for i := range endpoints {
+			e := &endpoints[i]
+			if c, ok := curr[e.Addr]; ok && c.equal(*e) {
+				e = c
+			}
+			next[e.Addr] = e
+			state.Addresses = append(state.Addresses, resolver.Address{
+				Addr:       e.Addr,
+				ServerName: e.ServerName,
+				Metadata:   e,
+			})
+		}
+		curr = next
+		cc.UpdateState(state)
+	})
+	h.start()
+
+	return &kvResolver{h: h}, nil
+}
+
+// Scheme returns the scheme this builder handles.
+func (b *Builder) Scheme() string {
+	return b.opts.scheme
+}
+
+type kvResolver struct {
+	h pollHandle
+}
+
+// ResolveNow triggers an immediate poll.
+func (k *kvResolver) ResolveNow(resolver.ResolveNowOption) {
+	k.h.triggerPoll()
+}
+
+// Close stops polling, cancelling any in-flight poll. It blocks until the
+// poll goroutine has exited. With shared polling the poll loop is only stopped
+// when the last resolver for the target is closed.
+func (k *kvResolver) Close() {
+	k.h.close()
+}
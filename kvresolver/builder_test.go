@@ -0,0 +1,143 @@
+package kvresolver
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/resolver"
+
+	"github.com/lstoll/grpce/helloproto"
+)
+
+func TestBuilderEndToEnd(t *testing.T) {
+	servNums := []string{"1", "2"}
+	var (
+		targetsMu sync.Mutex
+		targets   []string
+	)
+	for _, n := range servNums {
+		lis, err := net.Listen("tcp", "localhost:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := grpc.NewServer()
+		helloproto.RegisterHelloServer(s, &helloproto.TestHelloServer{ServerName: n})
+		go s.Serve(lis)
+		defer s.Stop()
+		targets = append(targets, lis.Addr().String())
+	}
+
+	lookup := func(key string) ([]string, error) {
+		if key != "testtarget" {
+			return nil, fmt.Errorf("Unknown target: %q", key)
+		}
+		targetsMu.Lock()
+		defer targetsMu.Unlock()
+		return append([]string{}, targets...), nil
+	}
+
+	b := NewBuilder(1*time.Millisecond, lookup,
+		WithScheme("kvbuildertest"),
+		WithServiceConfig(`{"loadBalancingPolicy":"round_robin"}`),
+		WithErrorReporter(&errprint{}),
+	)
+	resolver.Register(b)
+	defer resolver.UnregisterForTesting(b.Scheme())
+
+	conn, err := grpc.Dial("kvbuildertest:///testtarget",
+		grpc.WithInsecure(),
+		grpc.WithTimeout(1*time.Second),
+		grpc.WithBlock(),
+	)
+	if err != nil {
+		t.Fatalf("Error while dialing with a server list: %q", err)
+	}
+	defer conn.Close()
+
+	c := helloproto.NewHelloClient(conn)
+
+	// Wait for the balancer to pick up both addresses
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		seen := map[string]struct{}{}
+		for i := 0; i < 4; i++ {
+			resp, err := c.HelloWorld(context.Background(), &helloproto.HelloRequest{})
+			if err != nil {
+				t.Fatalf("Error calling RPC: %q", err)
+			}
+			seen[resp.ServerName] = struct{}{}
+		}
+		if len(seen) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected requests to be balanced over both servers, saw %v", seen)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Log("Removing first server from targets")
+	targetsMu.Lock()
+	targets = targets[1:]
+	targetsMu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	assertSeenInReqs(t, c, 4, []string{"2"})
+}
+
+type recordingClientConn struct {
+	resolver.ClientConn
+
+	states chan resolver.State
+}
+
+// UpdateState records the state, dropping it if the channel is full so a slow
+// test can't block the resolver.
+func (r *recordingClientConn) UpdateState(s resolver.State) {
+	select {
+	case r.states <- s:
+	default:
+	}
+}
+
+func TestBuilderResolveNow(t *testing.T) {
+	polls := make(chan string, 10)
+	lookup := func(key string) ([]string, error) {
+		polls <- key
+		return []string{"a:1", "b:2"}, nil
+	}
+
+	b := NewBuilder(time.Hour, lookup)
+	if b.Scheme() != Scheme {
+		t.Errorf("want scheme %q, got %q", Scheme, b.Scheme())
+	}
+
+	cc := &recordingClientConn{states: make(chan resolver.State, 10)}
+	r, err := b.Build(resolver.Target{Scheme: Scheme, Endpoint: "svc"}, cc, resolver.BuildOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for i := 0; i < 2; i++ {
+		if i > 0 {
+			r.ResolveNow(resolver.ResolveNowOption{})
+		}
+		select {
+		case key := <-polls:
+			if key != "svc" {
+				t.Errorf("want poll for %q, got %q", "svc", key)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for poll %d", i)
+		}
+		s := <-cc.states
+		if len(s.Addresses) != 2 || s.Addresses[0].Addr != "a:1" || s.Addresses[1].Addr != "b:2" {
+			t.Errorf("Unexpected addresses in state: %v", s.Addresses)
+		}
+	}
+}
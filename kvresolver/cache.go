@@ -0,0 +1,118 @@
+package kvresolver
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lstoll/grpce/reporters"
+)
+
+// WithCacheDir persists the last applied endpoint set for each target to a
+// file in dir. When a watcher starts it is seeded from this file, so a process
+// started while the KV store is unavailable still has endpoints. Cached
+// endpoints are considered stale until a poll succeeds.
+func WithCacheDir(dir string) KVROption {
+	return func(o *kvrOptions) {
+		o.cacheDir = dir
+	}
+}
+
+// cacheEntry is the on-disk format of the cache file.
+type cacheEntry struct {
+	Target    string     `json:"target"`
+	Updated   time.Time  `json:"updated"`
+	Endpoints []Endpoint `json:"endpoints"`
+}
+
+func (w *watcher) cachePath() string {
+	return filepath.Join(w.opts.cacheDir, url.PathEscape(w.target)+".json")
+}
+
+// loadCache seeds the watcher from the cache file, if there is one. The
+// endpoints are passed to update and marked stale. The first successful poll
+// replaces them without damping or the removal guard.
+func (w *watcher) loadCache() {
+	if w.opts.cacheDir == "" {
+		return
+	}
+	b, err := ioutil.ReadFile(w.cachePath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			reporters.ReportError(w.opts.errorReporter, err)
+		}
+		return
+	}
+	var ce cacheEntry
+	if err := json.Unmarshal(b, &ce); err != nil {
+		reporters.ReportError(w.opts.errorReporter, err)
+		return
+	}
+	if ce.Target != w.target || len(ce.Endpoints) == 0 {
+		return
+	}
+
+	w.statusMu.Lock()
+	w.lastSuccess = ce.Updated
+	w.stale = true
+	w.endpoints = ce.Endpoints
+	w.statusMu.Unlock()
+	reporters.ReportGauge(w.opts.metricsReporter, w.metricKey("stale"), 1)
+	reporters.ReportCount(w.opts.metricsReporter, "kvresolver.cache.loaded", 1)
+	w.cached = ce.Endpoints
+	w.seeded = true
+	w.update(ce.Endpoints)
+}
+
+// saveCache writes the endpoints to the cache file if they differ from what
+// was last written. The file is replaced atomically.
+func (w *watcher) saveCache(endpoints []Endpoint) {
+	if w.opts.cacheDir == "" || endpointsEqual(w.cached, endpoints) {
+		return
+	}
+	b, err := json.Marshal(&cacheEntry{
+		Target:    w.target,
+		Updated:   time.Now(),
+		Endpoints: endpoints,
+	})
+	if err != nil {
+		reporters.ReportError(w.opts.errorReporter, err)
+		return
+	}
+
+	tmp, err := ioutil.TempFile(w.opts.cacheDir, ".kvresolver")
+	if err != nil {
+		reporters.ReportError(w.opts.errorReporter, err)
+		return
+	}
+	_, err = tmp.Write(b)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), w.cachePath())
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		reporters.ReportError(w.opts.errorReporter, err)
+		return
+	}
+	w.cached = endpoints
+}
+
+// endpointsEqual returns true if both sets contain the same endpoints, in the
+// same order.
+func endpointsEqual(a, b []Endpoint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,111 @@
+package kvresolver
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+)
+
+func TestCacheSeedsColdStart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvresolver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	good := func(target string) ([]Endpoint, error) {
+		return []Endpoint{{Addr: "a:1", Version: "v1"}, {Addr: "b:1"}}, nil
+	}
+	cc := &recordingClientConn{states: make(chan resolver.State, 1)}
+	r, err := NewEndpointBuilder(time.Hour, good, WithCacheDir(dir)).Build(resolver.Target{Endpoint: "svc/a"}, cc, resolver.BuildOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-cc.states
+	r.Close()
+
+	if _, err := os.Stat(filepath.Join(dir, "svc%2Fa.json")); err != nil {
+		t.Fatalf("Cache file not written: %v", err)
+	}
+
+	bad := func(target string) ([]Endpoint, error) {
+		return nil, errors.New("KV unavailable")
+	}
+	mr := newMetricsRecorder()
+	cc = &recordingClientConn{states: make(chan resolver.State, 1)}
+	r, err = NewEndpointBuilder(time.Hour, bad, WithCacheDir(dir), WithMetricsReporter(mr)).Build(resolver.Target{Endpoint: "svc/a"}, cc, resolver.BuildOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	select {
+	case s := <-cc.states:
+		if len(s.Addresses) != 2 || s.Addresses[0].Addr != "a:1" || s.Addresses[1].Addr != "b:1" {
+			t.Errorf("Unexpected cached addresses %v", s.Addresses)
+		}
+		if md := s.Addresses[0].Metadata.(*Endpoint); md.Version != "v1" {
+			t.Errorf("want cached version %q, got %q", "v1", md.Version)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Resolver was not seeded from the cache")
+	}
+	if v, _ := mr.gauge("kvresolver.stale.svc/a"); v != 1 {
+		t.Error("Cached endpoints were not marked stale")
+	}
+}
+
+func TestCacheSeedNotGuarded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvresolver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	old := func(target string) ([]Endpoint, error) {
+		return addrEndpoints("old1:1", "old2:1"), nil
+	}
+	cc := &recordingClientConn{states: make(chan resolver.State, 1)}
+	r, err := NewEndpointBuilder(time.Hour, old, WithCacheDir(dir)).Build(resolver.Target{Endpoint: "svc"}, cc, resolver.BuildOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-cc.states
+	r.Close()
+
+	// Everything moved while the process was down. The guard and damping
+	// would hold on to the dead cached addresses if they applied to the seed.
+	moved := func(target string) ([]Endpoint, error) {
+		return addrEndpoints("new1:1", "new2:1"), nil
+	}
+	cc = &recordingClientConn{states: make(chan resolver.State, 2)}
+	r, err = NewEndpointBuilder(time.Hour, moved,
+		WithCacheDir(dir),
+		WithRemovalGuard(RemovalGuard{MaxRemovedPercent: 50}),
+		WithFlapDamping(FlapDamping{RemoveAfterPolls: 3, AddAfterPolls: 3}),
+	).Build(resolver.Target{Endpoint: "svc"}, cc, resolver.BuildOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for _, want := range []string{"old1:1,old2:1", "new1:1,new2:1"} {
+		select {
+		case s := <-cc.states:
+			var eps []Endpoint
+			for _, a := range s.Addresses {
+				eps = append(eps, Endpoint{Addr: a.Addr})
+			}
+			if got := endpointAddrs(eps); got != want {
+				t.Errorf("want %q, got %q", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Resolver was not updated with %q", want)
+		}
+	}
+}
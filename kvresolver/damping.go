@@ -0,0 +1,94 @@
+package kvresolver
+
+import "time"
+
+// FlapDamping smooths over eventually consistent listings that briefly miss,
+// or briefly show, an entry. Endpoints that disappear are kept until they have
+// been missing for every configured removal threshold, and new endpoints can
+// be held back until they have been seen for a number of polls.
+type FlapDamping struct {
+	// RemoveAfterPolls is the number of consecutive polls an endpoint must be
+	// missing from before it is removed.
+	RemoveAfterPolls int
+	// RemoveAfter is how long an endpoint must be missing before it is
+	// removed.
+	RemoveAfter time.Duration
+	// AddAfterPolls is the number of consecutive polls a new endpoint must be
+	// seen in before it is added.
+	AddAfterPolls int
+}
+
+// WithFlapDamping enables flap damping for the resolver.
+func WithFlapDamping(d FlapDamping) KVROption {
+	return func(o *kvrOptions) {
+		o.flapDamping = &d
+	}
+}
+
+// absence tracks an endpoint that has gone missing from polls.
+type absence struct {
+	polls int
+	since time.Time
+}
+
+// damp returns the endpoint set that should be used in place of next, keeping
+// recently missing endpoints and holding back unconfirmed new ones.
+func (w *watcher) damp(next []Endpoint) []Endpoint {
+	d := w.opts.flapDamping
+	if d == nil {
+		return next
+	}
+	if w.absent == nil {
+		w.absent = map[string]*absence{}
+		w.pending = map[string]int{}
+	}
+	now := time.Now()
+
+	inNext := make(map[string]bool, len(next))
+	for _, n := range next {
+		inNext[n.Addr] = true
+	}
+	inCurr := make(map[string]bool, len(w.endpoints))
+	for _, c := range w.endpoints {
+		inCurr[c.Addr] = true
+	}
+
+	ret := make([]Endpoint, 0, len(next))
+	for _, n := range next {
+		delete(w.absent, n.Addr)
+		if inCurr[n.Addr] || len(w.endpoints) == 0 {
+			// Known endpoints, and the initial seed, are used straight away.
+			delete(w.pending, n.Addr)
+			ret = append(ret, n)
+			continue
+		}
+		w.pending[n.Addr]++
+		if w.pending[n.Addr] >= d.AddAfterPolls {
+			delete(w.pending, n.Addr)
+			ret = append(ret, n)
+		}
+	}
+	for addr := range w.pending {
+		if !inNext[addr] {
+			delete(w.pending, addr)
+		}
+	}
+
+	for _, c := range w.endpoints {
+		if inNext[c.Addr] {
+			continue
+		}
+		a, ok := w.absent[c.Addr]
+		if !ok {
+			a = &absence{since: now}
+			w.absent[c.Addr] = a
+		}
+		a.polls++
+		if a.polls >= d.RemoveAfterPolls && now.Sub(a.since) >= d.RemoveAfter {
+			delete(w.absent, c.Addr)
+			continue
+		}
+		ret = append(ret, c)
+	}
+	return ret
+}
@@ -0,0 +1,62 @@
+package kvresolver
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func endpointAddrs(eps []Endpoint) string {
+	addrs := make([]string, 0, len(eps))
+	for _, e := range eps {
+		addrs = append(addrs, e.Addr)
+	}
+	sort.Strings(addrs)
+	return strings.Join(addrs, ",")
+}
+
+func TestFlapDampingPolls(t *testing.T) {
+	w := newWatcher("svc", time.Hour, nil, &kvrOptions{
+		flapDamping: &FlapDamping{RemoveAfterPolls: 3, AddAfterPolls: 2},
+	}, func([]Endpoint) {})
+
+	for i, s := range []struct {
+		next []Endpoint
+		want string
+	}{
+		{addrEndpoints("a", "b"), "a,b"},
+		{addrEndpoints("a"), "a,b"},
+		{addrEndpoints("a", "b"), "a,b"},
+		{addrEndpoints("a"), "a,b"},
+		{addrEndpoints("a"), "a,b"},
+		{addrEndpoints("a"), "a"},
+		{addrEndpoints("a", "c"), "a"},
+		{addrEndpoints("a"), "a"},
+		{addrEndpoints("a", "c"), "a"},
+		{addrEndpoints("a", "c"), "a,c"},
+	} {
+		w.apply(s.next)
+		if got := endpointAddrs(w.endpoints); got != s.want {
+			t.Errorf("poll %d: want %q, got %q", i, s.want, got)
+		}
+	}
+}
+
+func TestFlapDampingDuration(t *testing.T) {
+	w := newWatcher("svc", time.Hour, nil, &kvrOptions{
+		flapDamping: &FlapDamping{RemoveAfter: 20 * time.Millisecond},
+	}, func([]Endpoint) {})
+
+	w.apply(addrEndpoints("a", "b"))
+	w.apply(addrEndpoints("a"))
+	w.apply(addrEndpoints("a"))
+	if got := endpointAddrs(w.endpoints); got != "a,b" {
+		t.Errorf("want missing endpoint kept, got %q", got)
+	}
+	time.Sleep(25 * time.Millisecond)
+	w.apply(addrEndpoints("a"))
+	if got := endpointAddrs(w.endpoints); got != "a" {
+		t.Errorf("want missing endpoint removed, got %q", got)
+	}
+}
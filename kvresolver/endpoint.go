@@ -0,0 +1,107 @@
+package kvresolver
+
+import "context"
+
+// Endpoint is a single backend address for a target, along with any extra
+// information about it that balancers or credentials may want to use.
+// Endpoints are identified by their Addr, all other fields are passed through
+// as metadata.
+type Endpoint struct {
+	// Addr is the address to connect to. It is the endpoint's identity.
+	Addr string `json:"addr"`
+	// ServerName is the name used to verify the endpoint's TLS certificate.
+	ServerName string `json:"serverName,omitempty"`
+	// Weight is the relative weight of this endpoint for weighted balancers.
+	Weight int `json:"weight,omitempty"`
+	// AvailabilityZone the endpoint is running in.
+	AvailabilityZone string `json:"availabilityZone,omitempty"`
+	// CertFingerprint is the fingerprint of the certificate the endpoint is
+	// expected to present.
+	CertFingerprint string `json:"certFingerprint,omitempty"`
+	// Version of the software running on the endpoint.
+	Version string `json:"version,omitempty"`
+	// Metadata contains any other arbitrary data about the endpoint.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Generation is the version of this endpoint's record. It must increase
+	// every time the record is written. If a poll returns a record with a
+	// lower generation than one already seen, the newer record is kept. Zero
+	// means unversioned. Changes in generation alone are not passed on to
+	// balancers.
+	Generation uint64 `json:"generation,omitempty"`
+}
+
+// EndpointPollFunc is a poll function that returns structured Endpoints rather
+// than bare addresses.
+type EndpointPollFunc func(target string) ([]Endpoint, error)
+
+// ContextPollFunc is a poll function that takes a context. The context is
+// cancelled when the poll times out (see WithPollTimeout) or the resolver is
+// closed, and implementations should abandon any work when it is.
+type ContextPollFunc func(ctx context.Context, target string) ([]Endpoint, error)
+
+// View is a versioned endpoint set, as returned by a ViewPollFunc.
+type View struct {
+	// Generation is the version of the whole set. It must increase every
+	// time the set changes. Views with a lower generation than one already
+	// applied are rejected. Zero means unversioned.
+	Generation uint64
+	Endpoints  []Endpoint
+}
+
+// ViewPollFunc is a poll function that returns a versioned endpoint set, so
+// that an older view of an eventually consistent store can't roll back a
+// newer one.
+type ViewPollFunc func(ctx context.Context, target string) (View, error)
+
+// equal returns true if all the fields of the two endpoints, other than
+// their generation, match.
+func (e Endpoint) equal(o Endpoint) bool {
+	if e.Addr != o.Addr ||
+		e.ServerName != o.ServerName ||
+		e.Weight != o.Weight ||
+		e.AvailabilityZone != o.AvailabilityZone ||
+		e.CertFingerprint != o.CertFingerprint ||
+		e.Version != o.Version ||
+		len(e.Metadata) != len(o.Metadata) {
+		return false
+	}
+	for k, v := range e.Metadata {
+		if ov, ok := o.Metadata[k]; !ok || ov != v {
+			return false
+		}
+	}
+	return true
+}
+
+// addrPollFunc wraps a poll function that returns plain addresses as an
+// EndpointPollFunc.
+func addrPollFunc(pollFunc func(target string) ([]string, error)) EndpointPollFunc {
+	return func(target string) ([]Endpoint, error) {
+		addrs, err := pollFunc(target)
+		if err != nil {
+			return nil, err
+		}
+		eps := make([]Endpoint, 0, len(addrs))
+		for _, a := range addrs {
+			eps = append(eps, Endpoint{Addr: a})
+		}
+		return eps, nil
+	}
+}
+
+// viewPollFunc wraps a ContextPollFunc as an unversioned ViewPollFunc.
+func viewPollFunc(pollFunc ContextPollFunc) ViewPollFunc {
+	return func(ctx context.Context, target string) (View, error) {
+		eps, err := pollFunc(ctx, target)
+		return View{Endpoints: eps}, err
+	}
+}
+
+// contextPollFunc wraps an EndpointPollFunc as a ContextPollFunc. The context
+// is ignored, so a hung call can't be interrupted. The watcher will still stop
+// waiting on it, but the call's goroutine lives until it returns.
+func contextPollFunc(pollFunc EndpointPollFunc) ContextPollFunc {
+	return func(_ context.Context, target string) ([]Endpoint, error) {
+		return pollFunc(target)
+	}
+}
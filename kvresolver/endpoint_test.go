@@ -0,0 +1,87 @@
+package kvresolver
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/naming"
+	"google.golang.org/grpc/resolver"
+)
+
+func TestDiffEndpoints(t *testing.T) {
+	curr := []*Endpoint{
+		{Addr: "a:1", Weight: 1},
+		{Addr: "b:1", Version: "v1"},
+		{Addr: "c:1", Metadata: map[string]string{"k": "v"}},
+	}
+	next := []Endpoint{
+		{Addr: "a:1", Weight: 1},
+		{Addr: "b:1", Version: "v2"},
+		{Addr: "d:1", AvailabilityZone: "us-east-1a"},
+	}
+
+	updates, newCurr := diffEndpoints(curr, next)
+
+	want := []struct {
+		op   naming.Operation
+		addr string
+		md   Endpoint
+	}{
+		{naming.Delete, "b:1", *curr[1]},
+		{naming.Add, "b:1", next[1]},
+		{naming.Add, "d:1", next[2]},
+		{naming.Delete, "c:1", *curr[2]},
+	}
+	if len(updates) != len(want) {
+		t.Fatalf("want %d updates, got %d", len(want), len(updates))
+	}
+	for i, w := range want {
+		u := updates[i]
+		if u.Op != w.op || u.Addr != w.addr {
+			t.Errorf("update %d: want %v %q, got %v %q", i, w.op, w.addr, u.Op, u.Addr)
+		}
+		md, ok := u.Metadata.(*Endpoint)
+		if !ok || !md.equal(w.md) {
+			t.Errorf("update %d: want metadata %+v, got %+v", i, w.md, u.Metadata)
+		}
+	}
+
+	if len(newCurr) != 3 || newCurr[0] != curr[0] {
+		t.Errorf("Unchanged endpoint did not keep it's pointer")
+	}
+
+	if updates, _ := diffEndpoints(newCurr, next); len(updates) != 0 {
+		t.Errorf("want no updates for identical sets, got %d", len(updates))
+	}
+}
+
+func TestEndpointBuilderMetadata(t *testing.T) {
+	ep := Endpoint{
+		Addr:            "a:1",
+		ServerName:      "a.example.com",
+		CertFingerprint: "abcd",
+		Metadata:        map[string]string{"k": "v"},
+	}
+	lookup := func(key string) ([]Endpoint, error) {
+		return []Endpoint{ep}, nil
+	}
+
+	cc := &recordingClientConn{states: make(chan resolver.State, 1)}
+	r, err := NewEndpointBuilder(time.Hour, lookup).Build(resolver.Target{Endpoint: "svc"}, cc, resolver.BuildOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	s := <-cc.states
+	if len(s.Addresses) != 1 {
+		t.Fatalf("want 1 address, got %d", len(s.Addresses))
+	}
+	a := s.Addresses[0]
+	if a.Addr != ep.Addr || a.ServerName != ep.ServerName {
+		t.Errorf("want address %q/%q, got %q/%q", ep.Addr, ep.ServerName, a.Addr, a.ServerName)
+	}
+	if md, ok := a.Metadata.(*Endpoint); !ok || !md.equal(ep) {
+		t.Errorf("want metadata %+v, got %+v", ep, a.Metadata)
+	}
+}
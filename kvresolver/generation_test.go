@@ -0,0 +1,104 @@
+package kvresolver
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGenerationRejectsOlderViews(t *testing.T) {
+	mr := newMetricsRecorder()
+	var applied [][]Endpoint
+	w := newWatcher("svc", time.Hour, nil, &kvrOptions{metricsReporter: mr}, func(eps []Endpoint) {
+		applied = append(applied, eps)
+	})
+	views := []View{
+		{Generation: 2, Endpoints: []Endpoint{{Addr: "a:1"}, {Addr: "b:1"}}},
+		// A lagging replica, must not roll back.
+		{Generation: 1, Endpoints: []Endpoint{{Addr: "a:1"}}},
+		{Generation: 3, Endpoints: []Endpoint{{Addr: "b:1"}}},
+		// Unversioned views are applied, but don't reset the generation.
+		{Endpoints: []Endpoint{{Addr: "c:1"}}},
+		{Generation: 2, Endpoints: []Endpoint{{Addr: "a:1"}}},
+	}
+	for i, v := range views {
+		v := v
+		w.pollFunc = func(ctx context.Context, target string) (View, error) {
+			return v, nil
+		}
+		if err := w.poll(); err != nil {
+			t.Fatalf("poll %d: %v", i, err)
+		}
+	}
+
+	if len(applied) != 3 {
+		t.Fatalf("want 3 applied views, got %d: %v", len(applied), applied)
+	}
+	if len(applied[1]) != 1 || applied[1][0].Addr != "b:1" {
+		t.Errorf("Unexpected endpoints %v", applied[1])
+	}
+	if len(applied[2]) != 1 || applied[2][0].Addr != "c:1" {
+		t.Errorf("Unexpected final endpoints %v", applied[2])
+	}
+	if c := mr.count("kvresolver.generation.rejected"); c != 2 {
+		t.Errorf("want 2 rejected views, got %d", c)
+	}
+}
+
+func TestGenerationPrunesRemovedEndpoints(t *testing.T) {
+	w := newWatcher("svc", time.Hour, nil, &kvrOptions{}, func(eps []Endpoint) {})
+	polls := [][]Endpoint{
+		{{Addr: "a:1", Generation: 1}, {Addr: "b:1", Generation: 1}},
+		{{Addr: "a:1", Generation: 2}},
+	}
+	for i, eps := range polls {
+		eps := eps
+		w.pollFunc = viewPollFunc(func(ctx context.Context, target string) ([]Endpoint, error) {
+			return eps, nil
+		})
+		if err := w.poll(); err != nil {
+			t.Fatalf("poll %d: %v", i, err)
+		}
+	}
+	if len(w.generations) != 1 || w.generations["a:1"] != 2 {
+		t.Errorf("want only a:1's generation kept, got %v", w.generations)
+	}
+}
+
+func TestGenerationKeepsNewerEndpoints(t *testing.T) {
+	mr := newMetricsRecorder()
+	var last []Endpoint
+	w := newWatcher("svc", time.Hour, nil, &kvrOptions{metricsReporter: mr}, func(eps []Endpoint) {
+		last = eps
+	})
+	polls := [][]Endpoint{
+		{{Addr: "a:1", Version: "v2", Generation: 20}, {Addr: "b:1", Generation: 5}},
+		// a:1's record is older than the one we have, b:1's is newer.
+		{{Addr: "a:1", Version: "v1", Generation: 10}, {Addr: "b:1", Version: "v2", Generation: 6}},
+	}
+	for i, eps := range polls {
+		eps := eps
+		w.pollFunc = viewPollFunc(func(ctx context.Context, target string) ([]Endpoint, error) {
+			return eps, nil
+		})
+		if err := w.poll(); err != nil {
+			t.Fatalf("poll %d: %v", i, err)
+		}
+	}
+
+	if len(last) != 2 || last[0].Version != "v2" || last[1].Version != "v2" {
+		t.Errorf("want newest record of each endpoint, got %+v", last)
+	}
+	if polls[1][0].Version != "v1" {
+		t.Error("Poll function's endpoints were modified")
+	}
+	if c := mr.count("kvresolver.generation.rejected.endpoints"); c != 1 {
+		t.Errorf("want 1 rejected endpoint, got %d", c)
+	}
+}
+
+func TestEqualIgnoresGeneration(t *testing.T) {
+	if !(Endpoint{Addr: "a:1", Generation: 1}).equal(Endpoint{Addr: "a:1", Generation: 2}) {
+		t.Error("Generation change alone should not change the endpoint")
+	}
+}
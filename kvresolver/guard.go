@@ -0,0 +1,85 @@
+package kvresolver
+
+import (
+	"fmt"
+
+	"github.com/lstoll/grpce/reporters"
+)
+
+// RemovalGuard protects against a bad write to the KV store, like a truncated
+// registry object, removing every backend at once. Updates that would remove
+// more than MaxRemovedPercent of the current endpoints, or leave fewer than
+// MinRemaining, are suppressed until they have been seen for ConfirmPolls
+// consecutive polls.
+type RemovalGuard struct {
+	// MaxRemovedPercent is the largest percentage of the current endpoints a
+	// single update may remove. 0 disables the check.
+	MaxRemovedPercent int
+	// MinRemaining is the fewest endpoints an update may leave. 0 disables the
+	// check.
+	MinRemaining int
+	// ConfirmPolls is the number of consecutive polls an update that trips the
+	// guard must be seen for before it's applied anyway. 0 means it is never
+	// applied.
+	ConfirmPolls int
+}
+
+// SuppressedUpdateError is reported when the removal guard refuses to apply
+// an update.
+type SuppressedUpdateError struct {
+	Target  string
+	Current int
+	Removed int
+	// Poll is the number of consecutive polls this update has been suppressed
+	// for, including this one.
+	Poll int
+}
+
+func (s *SuppressedUpdateError) Error() string {
+	return fmt.Sprintf("kvresolver: suppressed update for %q removing %d of %d endpoints (poll %d)", s.Target, s.Removed, s.Current, s.Poll)
+}
+
+// WithRemovalGuard enables the removal guard for the resolver.
+func WithRemovalGuard(g RemovalGuard) KVROption {
+	return func(o *kvrOptions) {
+		o.removalGuard = &g
+	}
+}
+
+// guardAllows returns true if the next endpoint set may be applied. Updates
+// that trip the guard are reported, and counted in
+// "kvresolver.guard.suppressed".
+func (w *watcher) guardAllows(next []Endpoint) bool {
+	g := w.opts.removalGuard
+	if g == nil || len(w.endpoints) == 0 {
+		return true
+	}
+
+	removed := 0
+	for _, c := range w.endpoints {
+		if !containsAddr(next, c.Addr) {
+			removed++
+		}
+	}
+
+	tripped := (g.MaxRemovedPercent > 0 && removed*100 > g.MaxRemovedPercent*len(w.endpoints)) ||
+		(g.MinRemaining > 0 && removed > 0 && len(next) < g.MinRemaining)
+	if !tripped {
+		w.guardTrips = 0
+		return true
+	}
+
+	w.guardTrips++
+	if g.ConfirmPolls > 0 && w.guardTrips >= g.ConfirmPolls {
+		w.guardTrips = 0
+		return true
+	}
+	reporters.ReportError(w.opts.errorReporter, &SuppressedUpdateError{
+		Target:  w.target,
+		Current: len(w.endpoints),
+		Removed: removed,
+		Poll:    w.guardTrips,
+	})
+	reporters.ReportCount(w.opts.metricsReporter, "kvresolver.guard.suppressed", 1)
+	return false
+}
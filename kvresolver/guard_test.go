@@ -0,0 +1,69 @@
+package kvresolver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lstoll/grpce/reporters/reporterstest"
+)
+
+func addrEndpoints(addrs ...string) []Endpoint {
+	eps := make([]Endpoint, 0, len(addrs))
+	for _, a := range addrs {
+		eps = append(eps, Endpoint{Addr: a})
+	}
+	return eps
+}
+
+func TestRemovalGuard(t *testing.T) {
+	ec := &reporterstest.ErrorCollector{}
+	mr := newMetricsRecorder()
+	var applied [][]Endpoint
+	w := newWatcher("svc", time.Hour, nil, &kvrOptions{
+		errorReporter:   ec,
+		metricsReporter: mr,
+		removalGuard:    &RemovalGuard{MaxRemovedPercent: 50, MinRemaining: 3, ConfirmPolls: 3},
+	}, func(eps []Endpoint) {
+		applied = append(applied, eps)
+	})
+
+	steps := []struct {
+		name    string
+		next    []Endpoint
+		applied bool
+	}{
+		{"initial seed is never guarded", addrEndpoints("a", "b", "c", "d"), true},
+		{"removing half is allowed", addrEndpoints("a", "b", "e"), true},
+		{"removing more than half is suppressed", addrEndpoints("a"), false},
+		{"still suppressed on second poll", addrEndpoints("a"), false},
+		{"applied once confirmed", addrEndpoints("a"), true},
+		{"additions are never guarded", addrEndpoints("a", "b", "c", "d", "e"), true},
+		{"removing two of five is allowed", addrEndpoints("a", "b", "c"), true},
+		{"leaving too few is suppressed", addrEndpoints("a", "b"), false},
+		{"a good poll resets the count", addrEndpoints("a", "b", "c", "f"), true},
+		{"truncation is suppressed again", addrEndpoints(), false},
+	}
+	for _, s := range steps {
+		before := len(applied)
+		w.apply(s.next)
+		if got := len(applied) > before; got != s.applied {
+			t.Fatalf("%s: want applied %t, got %t", s.name, s.applied, got)
+		}
+	}
+
+	var suppressed int
+	for _, err := range ec.Errors() {
+		if _, ok := err.(*SuppressedUpdateError); ok {
+			suppressed++
+		}
+	}
+	if suppressed != 4 {
+		t.Errorf("want 4 suppressed updates reported, got %d", suppressed)
+	}
+	if c := mr.count("kvresolver.guard.suppressed"); c != 4 {
+		t.Errorf("want 4 suppressed updates counted, got %d", c)
+	}
+	if len(w.endpoints) != 4 {
+		t.Errorf("want the last good set of 4 endpoints to be current, got %d", len(w.endpoints))
+	}
+}
@@ -11,20 +11,31 @@ import (
 
 type pollResolver struct {
 	target       string
-	pollFunc     func(target string) ([]string, error)
+	pollFunc     ViewPollFunc
 	pollInterval time.Duration
 	opts         *kvrOptions
+	shared       *sharedPollers
 }
 
 type pollWatcher struct {
+	w             pollHandle
 	updChan       chan []*naming.Update
-	closeChan     chan struct{}
-	currAddresses []string
+	currEndpoints []*Endpoint
 }
 
 type kvrOptions struct {
 	errorReporter   reporters.ErrorReporter
 	metricsReporter reporters.MetricsReporter
+	scheme          string
+	serviceConfig   string
+	pollTimeout     time.Duration
+	jitter          float64
+	maxBackoff      time.Duration
+	staleAfter      time.Duration
+	removalGuard    *RemovalGuard
+	flapDamping     *FlapDamping
+	cacheDir        string
+	sharedPolling   bool
 }
 
 type KVROption func(*kvrOptions)
@@ -41,99 +52,193 @@ func WithMetricsReporter(mr reporters.MetricsReporter) KVROption {
 	}
 }
 
+// WithScheme overrides the scheme a Builder is registered under. This allows
+// multiple builders with different poll functions to be registered at once.
+// It has no effect on resolvers returned by New.
+func WithScheme(scheme string) KVROption {
+	return func(o *kvrOptions) {
+		o.scheme = scheme
+	}
+}
+
+// WithServiceConfig sets the JSON service config that a Builder's resolvers
+// pass to the ClientConn along with each address update. This can be used to
+// select the load balancing policy. It has no effect on resolvers returned by
+// New.
+func WithServiceConfig(serviceConfig string) KVROption {
+	return func(o *kvrOptions) {
+		o.serviceConfig = serviceConfig
+	}
+}
+
+// WithPollTimeout bounds how long each call to the poll function may take. The
+// context passed to a ContextPollFunc is cancelled once it elapses, and the
+// poll is treated as failed. By default polls are only cancelled when the
+// resolver is closed.
+func WithPollTimeout(timeout time.Duration) KVROption {
+	return func(o *kvrOptions) {
+		o.pollTimeout = timeout
+	}
+}
+
+// WithJitter randomises each poll interval by up to +/- fraction of itself,
+// e.g 0.1 for 10%. This stops clients started at the same time, like those in
+// an ASG, polling in lockstep.
+func WithJitter(fraction float64) KVROption {
+	return func(o *kvrOptions) {
+		o.jitter = fraction
+	}
+}
+
+// WithBackoff enables exponential backoff when the poll function fails. The
+// poll interval is doubled for each consecutive failure, up to max, and reset
+// on the next success. ResolveNow requests are ignored while backing off.
+func WithBackoff(max time.Duration) KVROption {
+	return func(o *kvrOptions) {
+		o.maxBackoff = max
+	}
+}
+
+// WithStaleAfter sets how long the last known good endpoints can go without a
+// successful poll before they are considered stale. Failed polls never clear
+// the endpoint list, so the stale endpoints continue to be served, but when
+// the threshold is crossed a *StaleError is reported and the
+// "kvresolver.stale.<target>" gauge is set to 1 until a poll succeeds.
+func WithStaleAfter(after time.Duration) KVROption {
+	return func(o *kvrOptions) {
+		o.staleAfter = after
+	}
+}
+
+// New returns a naming.Resolver that polls pollFunc for target's addresses
+// every pollInterval.
+//
+// Deprecated: naming.Resolver only works with grpc.RoundRobin, use NewBuilder
+// instead.
 func New(target string, pollInterval time.Duration, pollFunc func(target string) ([]string, error), opts ...KVROption) naming.Resolver {
+	return NewWithEndpoints(target, pollInterval, addrPollFunc(pollFunc), opts...)
+}
+
+// NewWithEndpoints returns a naming.Resolver that polls pollFunc for target's
+// endpoints every pollInterval. Each update's Metadata is a *Endpoint for the
+// endpoint it was generated from.
+//
+// Deprecated: naming.Resolver only works with grpc.RoundRobin, use
+// NewEndpointBuilder instead.
+func NewWithEndpoints(target string, pollInterval time.Duration, pollFunc EndpointPollFunc, opts ...KVROption) naming.Resolver {
+	return NewWithContext(target, pollInterval, contextPollFunc(pollFunc), opts...)
+}
+
+// NewWithContext returns a naming.Resolver that polls pollFunc for target's
+// endpoints every pollInterval. Each update's Metadata is a *Endpoint for the
+// endpoint it was generated from. Closing the watcher cancels any in-flight
+// poll.
+//
+// Deprecated: naming.Resolver only works with grpc.RoundRobin, use
+// NewContextBuilder instead.
+func NewWithContext(target string, pollInterval time.Duration, pollFunc ContextPollFunc, opts ...KVROption) naming.Resolver {
+	return NewWithView(target, pollInterval, viewPollFunc(pollFunc), opts...)
+}
+
+// NewWithView returns a naming.Resolver that polls pollFunc for a versioned
+// view of target's endpoints every pollInterval. Views older than the last one
+// applied are rejected.
+//
+// Deprecated: naming.Resolver only works with grpc.RoundRobin, use
+// NewViewBuilder instead.
+func NewWithView(target string, pollInterval time.Duration, pollFunc ViewPollFunc, opts ...KVROption) naming.Resolver {
 	kvo := &kvrOptions{}
 	for _, opt := range opts {
 		opt(kvo)
 	}
 
-	return &pollResolver{
+	p := &pollResolver{
 		target:       target,
 		pollFunc:     pollFunc,
 		pollInterval: pollInterval,
 		opts:         kvo,
 	}
+	if kvo.sharedPolling {
+		p.shared = newSharedPollers()
+	}
+	return p
 }
 
 func (p *pollResolver) Resolve(target string) (naming.Watcher, error) {
 	uc := make(chan []*naming.Update)
-	cc := make(chan struct{})
 
 	pw := &pollWatcher{
 		updChan:       uc,
-		closeChan:     cc,
-		currAddresses: []string{},
+		currEndpoints: []*Endpoint{},
 	}
 
-	updateAddrs := func() error {
-		updates := []*naming.Update{}
-		addresses, err := p.pollFunc(p.target)
-		if err != nil {
-			reporters.ReportError(p.opts.errorReporter, err)
-			reporters.ReportCount(p.opts.metricsReporter, "kvresolver.pollfunc.errors", 1)
-			return err
-		}
-		// for each address that we found that isn't in the current state, send an update
-		for _, a := range addresses {
-			found := false
-			for _, curr := range pw.currAddresses {
-				if a == curr {
-					found = true
-					break
-				}
-			}
-			if !found {
-				updates = append(updates, &naming.Update{Op: naming.Add, Addr: a})
-			}
+	pw.w = newPollHandle(p.shared, p.target, p.pollInterval, p.pollFunc, p.opts, func(endpoints []Endpoint) {
+		var updates []*naming.Update
+		updates, pw.currEndpoints = diffEndpoints(pw.currEndpoints, endpoints)
+		select {
+		case uc <- updates:
+		case <-pw.w.done():
 		}
+	})
 
-		// for each address that is in the current state but isn't in the found, send a delete
-		for _, curr := range pw.currAddresses {
-			found := false
-			for _, a := range addresses {
-				if curr == a {
-					found = true
-					break
-				}
-			}
-			if !found {
-				updates = append(updates, &naming.Update{Op: naming.Delete, Addr: curr})
-			}
-		}
+	pw.w.start()
 
-		pw.currAddresses = addresses
-		uc <- updates
+	return pw, nil
+}
 
-		return nil
+// diffEndpoints returns the naming updates needed to move from the curr
+// endpoint set to the next one, along with the new current set. Endpoints are
+// matched by address, if an endpoint's other fields have changed it is deleted
+// and re-added so the balancer sees the new metadata. The balancer compares
+// metadata, so unchanged endpoints keep the pointer they were added with.
+func diffEndpoints(curr []*Endpoint, next []Endpoint) ([]*naming.Update, []*Endpoint) {
+	updates := []*naming.Update{}
+	newCurr := make([]*Endpoint, 0, len(next))
+	// for each endpoint that we found that isn't in the current state, send an update
+	for i := range next {
+		e := &next[i]
+		var found *Endpoint
+		for _, c := range curr {
+			if e.Addr == c.Addr {
+				found = c
+				break
+			}
+		}
+		switch {
+		case found == nil:
+			updates = append(updates, &naming.Update{Op: naming.Add, Addr: e.Addr, Metadata: e})
+		case !found.equal(*e):
+			updates = append(updates,
+				&naming.Update{Op: naming.Delete, Addr: found.Addr, Metadata: found},
+				&naming.Update{Op: naming.Add, Addr: e.Addr, Metadata: e},
+			)
+		default:
+			e = found
+		}
+		newCurr = append(newCurr, e)
 	}
 
-	go func() {
-		defer close(uc)
-
-		// Initial seed.
-		updateAddrs()
-
-		ticker := time.NewTicker(p.pollInterval)
-		for {
-			select {
-			case _, ok := <-cc:
-				if !ok {
-					ticker.Stop()
-					return
-				}
-			case _ = <-ticker.C:
-				if err := updateAddrs(); err != nil {
-					break
-				}
+	// for each endpoint that is in the current state but isn't in the found, send a delete
+	for _, c := range curr {
+		found := false
+		for _, e := range next {
+			if c.Addr == e.Addr {
+				found = true
+				break
 			}
 		}
-	}()
-
-	return pw, nil
+		if !found {
+			updates = append(updates, &naming.Update{Op: naming.Delete, Addr: c.Addr, Metadata: c})
+		}
+	}
+	return updates, newCurr
 }
 
+// Close stops the watcher, cancelling any in-flight poll. It blocks until the
+// poll goroutine has exited. With shared polling the poll loop is only stopped
+// when the last watcher for the target is closed.
 func (p *pollWatcher) Close() {
-	close(p.closeChan)
+	p.w.close()
 }
 
 func (p *pollWatcher) Next() ([]*naming.Update, error) {
@@ -143,10 +248,7 @@ func (p *pollWatcher) Next() ([]*naming.Update, error) {
 			return nil, errors.New("Closed update channel")
 		}
 		return ret, nil
-	case _, ok := <-p.closeChan:
-		if !ok {
-			return nil, errors.New("Watcher closed")
-		}
+	case <-p.w.done():
+		return nil, errors.New("Watcher closed")
 	}
-	return nil, errors.New("How did we get here")
 }
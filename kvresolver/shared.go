@@ -0,0 +1,195 @@
+package kvresolver
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WithSharedPolling makes all resolvers created by the same Builder, or
+// watchers created by the same naming.Resolver, share a single poll loop per
+// target. Updates are fanned out to each of them, and the loop is stopped when
+// the last one is closed. This saves calls to the KV store when a process has
+// many ClientConns for the same target.
+func WithSharedPolling() KVROption {
+	return func(o *kvrOptions) {
+		o.sharedPolling = true
+	}
+}
+
+// pollHandle is what a resolver holds on to for it's source of updates,
+// either it's own watcher or a subscription to a shared one.
+type pollHandle interface {
+	// start begins delivering updates.
+	start()
+	triggerPoll()
+	done() <-chan struct{}
+	close()
+}
+
+// start runs the poll loop in a new goroutine.
+func (w *watcher) start() {
+	go w.run()
+}
+
+// newPollHandle returns a handle that calls update with endpoints for target.
+// If shared is nil it gets a dedicated watcher, otherwise it subscribes to the
+// target's shared watcher. The handle must be started.
+func newPollHandle(shared *sharedPollers, target string, pollInterval time.Duration, pollFunc ViewPollFunc, opts *kvrOptions, update func(endpoints []Endpoint)) pollHandle {
+	if shared == nil {
+		return newWatcher(target, pollInterval, pollFunc, opts, update)
+	}
+	return shared.subscribe(target, func(update func([]Endpoint)) *watcher {
+		return newWatcher(target, pollInterval, pollFunc, opts, update)
+	}, update)
+}
+
+// sharedPollers tracks the shared watcher for each target.
+type sharedPollers struct {
+	mu      sync.Mutex
+	pollers map[string]*sharedPoller
+}
+
+func newSharedPollers() *sharedPollers {
+	return &sharedPollers{pollers: map[string]*sharedPoller{}}
+}
+
+// sharedPoller is a watcher shared between subscriptions. Fields other than w
+// are guarded by sharedPollers.mu.
+type sharedPoller struct {
+	w      *watcher
+	subs   map[*subscription]struct{}
+	last   []Endpoint
+	seeded bool
+}
+
+// subscribe adds a subscription to target's watcher, creating it with
+// newWatcher if there isn't one running.
+func (s *sharedPollers) subscribe(target string, newWatcher func(update func([]Endpoint)) *watcher, update func([]Endpoint)) *subscription {
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := &subscription{
+		parent: s,
+		target: target,
+		update: update,
+		notify: make(chan struct{}, 1),
+		ctx:    ctx,
+		cancel: cancel,
+		exited: make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sp, ok := s.pollers[target]
+	if !ok {
+		sp = &sharedPoller{subs: map[*subscription]struct{}{}}
+		sp.w = newWatcher(func(endpoints []Endpoint) {
+			s.broadcast(sp, endpoints)
+		})
+		s.pollers[target] = sp
+		sp.w.start()
+	}
+	sub.sp = sp
+	sp.subs[sub] = struct{}{}
+	if sp.seeded {
+		sub.set(sp.last)
+	}
+	return sub
+}
+
+// broadcast records the endpoints as the latest for the poller, and passes
+// them to each subscription.
+func (s *sharedPollers) broadcast(sp *sharedPoller, endpoints []Endpoint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sp.last = endpoints
+	sp.seeded = true
+	for sub := range sp.subs {
+		sub.set(endpoints)
+	}
+}
+
+// unsubscribe removes the subscription, stopping the watcher if it was the
+// last one.
+func (s *sharedPollers) unsubscribe(sub *subscription) {
+	s.mu.Lock()
+	sp := sub.sp
+	delete(sp.subs, sub)
+	last := len(sp.subs) == 0
+	if last {
+		delete(s.pollers, sub.target)
+	}
+	s.mu.Unlock()
+
+	if last {
+		sp.w.close()
+	}
+}
+
+// subscription delivers a shared watcher's updates to one resolver. Each has
+// it's own goroutine, so a slow resolver doesn't hold up the others. If
+// updates arrive faster than they are delivered only the latest is kept.
+type subscription struct {
+	parent *sharedPollers
+	sp     *sharedPoller
+	target string
+	update func([]Endpoint)
+
+	mu     sync.Mutex
+	latest []Endpoint
+	notify chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	exited chan struct{}
+	once   sync.Once
+}
+
+// set replaces the pending update for the subscription.
+func (s *subscription) set(endpoints []Endpoint) {
+	s.mu.Lock()
+	s.latest = endpoints
+	s.mu.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscription) start() {
+	go s.run()
+}
+
+func (s *subscription) run() {
+	defer close(s.exited)
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-s.notify:
+			s.mu.Lock()
+			endpoints := s.latest
+			s.mu.Unlock()
+			s.update(endpoints)
+		}
+	}
+}
+
+func (s *subscription) triggerPoll() {
+	s.sp.w.triggerPoll()
+}
+
+func (s *subscription) done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+// close stops delivering updates, and releases the subscription's reference
+// on the shared watcher. It is safe to call multiple times.
+func (s *subscription) close() {
+	s.once.Do(func() {
+		s.cancel()
+		<-s.exited
+		s.parent.unsubscribe(s)
+	})
+}
@@ -0,0 +1,72 @@
+package kvresolver
+
+import (
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+)
+
+func TestSharedPolling(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	var polls int32
+	lookup := func(target string) ([]Endpoint, error) {
+		atomic.AddInt32(&polls, 1)
+		return []Endpoint{{Addr: "a:1"}}, nil
+	}
+	b := NewEndpointBuilder(time.Hour, lookup, WithSharedPolling())
+
+	var (
+		ccs       []*recordingClientConn
+		resolvers []resolver.Resolver
+	)
+	for i := 0; i < 3; i++ {
+		cc := &recordingClientConn{states: make(chan resolver.State, 10)}
+		r, err := b.Build(resolver.Target{Endpoint: "svc"}, cc, resolver.BuildOption{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ccs = append(ccs, cc)
+		resolvers = append(resolvers, r)
+	}
+
+	for i, cc := range ccs {
+		select {
+		case s := <-cc.states:
+			if len(s.Addresses) != 1 {
+				t.Errorf("resolver %d: want 1 address, got %d", i, len(s.Addresses))
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("resolver %d: never received an update", i)
+		}
+	}
+	if p := atomic.LoadInt32(&polls); p != 1 {
+		t.Errorf("want 1 poll for all resolvers, got %d", p)
+	}
+
+	resolvers[1].ResolveNow(resolver.ResolveNowOption{})
+	for i, cc := range ccs {
+		select {
+		case <-cc.states:
+		case <-time.After(time.Second):
+			t.Fatalf("resolver %d: ResolveNow update not fanned out", i)
+		}
+	}
+	if p := atomic.LoadInt32(&polls); p != 2 {
+		t.Errorf("want 2 polls after ResolveNow, got %d", p)
+	}
+
+	resolvers[0].Close()
+	resolvers[1].Close()
+	if len(b.shared.pollers) != 1 {
+		t.Error("Shared poller stopped while a resolver was still open")
+	}
+	resolvers[2].Close()
+	if len(b.shared.pollers) != 0 {
+		t.Error("Shared poller still registered after the last resolver closed")
+	}
+	waitForGoroutines(t, before)
+}
@@ -0,0 +1,124 @@
+package kvresolver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// active tracks all running watchers in the process, for Statuses.
+var active = struct {
+	mu       sync.Mutex
+	watchers map[*watcher]struct{}
+}{watchers: map[*watcher]struct{}{}}
+
+func trackWatcher(w *watcher) {
+	active.mu.Lock()
+	defer active.mu.Unlock()
+	active.watchers[w] = struct{}{}
+}
+
+func untrackWatcher(w *watcher) {
+	active.mu.Lock()
+	defer active.mu.Unlock()
+	delete(active.watchers, w)
+}
+
+// Status is a snapshot of the state of a running watcher.
+type Status struct {
+	Target              string     `json:"target"`
+	Endpoints           []Endpoint `json:"endpoints"`
+	LastPoll            time.Time  `json:"lastPoll"`
+	LastSuccess         time.Time  `json:"lastSuccess"`
+	LastError           string     `json:"lastError,omitempty"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	Stale               bool       `json:"stale"`
+}
+
+// Statuses returns the status of every running watcher in the process, sorted
+// by target. With shared polling each target's shared watcher is only listed
+// once.
+func Statuses() []Status {
+	active.mu.Lock()
+	ws := make([]*watcher, 0, len(active.watchers))
+	for w := range active.watchers {
+		ws = append(ws, w)
+	}
+	active.mu.Unlock()
+
+	ret := make([]Status, 0, len(ws))
+	for _, w := range ws {
+		ret = append(ret, w.status())
+	}
+	sort.SliceStable(ret, func(i, j int) bool { return ret[i].Target < ret[j].Target })
+	return ret
+}
+
+func (w *watcher) status() Status {
+	w.statusMu.Lock()
+	defer w.statusMu.Unlock()
+	s := Status{
+		Target:              w.target,
+		Endpoints:           w.endpoints,
+		LastPoll:            w.lastPoll,
+		LastSuccess:         w.lastSuccess,
+		ConsecutiveFailures: w.failures,
+		Stale:               w.stale,
+	}
+	if w.lastErr != nil {
+		s.LastError = w.lastErr.Error()
+	}
+	return s
+}
+
+// Handler returns an http.Handler that serves the Statuses of all running
+// watchers. It responds with JSON if the request has ?format=json or accepts
+// application/json, otherwise with plain text.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		statuses := Statuses()
+
+		if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(statuses); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if len(statuses) == 0 {
+			fmt.Fprintln(w, "No active watchers")
+			return
+		}
+		for _, s := range statuses {
+			tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+			fmt.Fprintf(tw, "Target:\t%s\n", s.Target)
+			fmt.Fprintf(tw, "Last poll:\t%s\n", formatTime(s.LastPoll))
+			fmt.Fprintf(tw, "Last success:\t%s\n", formatTime(s.LastSuccess))
+			fmt.Fprintf(tw, "Last error:\t%s\n", s.LastError)
+			fmt.Fprintf(tw, "Consecutive failures:\t%d\n", s.ConsecutiveFailures)
+			fmt.Fprintf(tw, "Stale:\t%t\n", s.Stale)
+			fmt.Fprintf(tw, "Endpoints:\t%d\n", len(s.Endpoints))
+			for _, e := range s.Endpoints {
+				fmt.Fprintf(tw, "\t%s\t%s\t%s\n", e.Addr, e.AvailabilityZone, e.Version)
+			}
+			tw.Flush()
+			fmt.Fprintln(w)
+		}
+	})
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return fmt.Sprintf("%s (%s ago)", t.Format(time.RFC3339), time.Since(t).Round(time.Millisecond))
+}
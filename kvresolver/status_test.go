@@ -0,0 +1,106 @@
+package kvresolver
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+)
+
+func TestStatusHandler(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		failing bool
+	)
+	lookup := func(target string) ([]string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failing {
+			return nil, errors.New("KV unavailable")
+		}
+		return []string{"a:1", "b:1"}, nil
+	}
+
+	cc := &recordingClientConn{states: make(chan resolver.State, 1)}
+	r, err := NewBuilder(time.Hour, lookup).Build(resolver.Target{Endpoint: "statustarget"}, cc, resolver.BuildOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-cc.states
+
+	mu.Lock()
+	failing = true
+	mu.Unlock()
+	r.ResolveNow(resolver.ResolveNowOption{})
+
+	var st Status
+	deadline := time.Now().Add(time.Second)
+	for {
+		for _, s := range Statuses() {
+			if s.Target == "statustarget" {
+				st = s
+			}
+		}
+		if st.ConsecutiveFailures == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Failure never recorded in status %+v", st)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if st.LastError != "KV unavailable" || len(st.Endpoints) != 2 || st.LastPoll.IsZero() {
+		t.Errorf("Unexpected status %+v", st)
+	}
+
+	ts := httptest.NewServer(Handler())
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL + "?format=json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses []Status
+	err = json.NewDecoder(resp.Body).Decode(&statuses)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, s := range statuses {
+		if s.Target == "statustarget" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Target not found in JSON status")
+	}
+
+	resp, err = ts.Client().Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"statustarget", "KV unavailable", "a:1", "b:1"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("want %q in text status, got:\n%s", want, body)
+		}
+	}
+
+	r.Close()
+	for _, s := range Statuses() {
+		if s.Target == "statustarget" {
+			t.Error("Closed watcher still listed")
+		}
+	}
+}
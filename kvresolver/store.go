@@ -0,0 +1,43 @@
+package kvresolver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/lstoll/grpce/kv"
+)
+
+// StorePollFunc returns a ContextPollFunc that reads a target's endpoints from
+// a KV store. Each object under prefix + target + "/" is a JSON encoded
+// Endpoint. If an endpoint has no Addr, the last element of it's key is used.
+// Objects deleted between being listed and fetched are skipped.
+func StorePollFunc(store kv.Store, prefix string) ContextPollFunc {
+	return func(ctx context.Context, target string) ([]Endpoint, error) {
+		infos, err := store.List(ctx, prefix+target+"/")
+		if err != nil {
+			return nil, err
+		}
+
+		eps := make([]Endpoint, 0, len(infos))
+		for _, info := range infos {
+			o, err := store.Get(ctx, info.Key)
+			if err == kv.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			var e Endpoint
+			if err := json.Unmarshal(o.Value, &e); err != nil {
+				return nil, fmt.Errorf("kvresolver: parsing endpoint %q: %v", info.Key, err)
+			}
+			if e.Addr == "" {
+				e.Addr = path.Base(info.Key)
+			}
+			eps = append(eps, e)
+		}
+		return eps, nil
+	}
+}
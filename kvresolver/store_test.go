@@ -0,0 +1,121 @@
+package kvresolver
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/resolver"
+
+	"github.com/lstoll/grpce/helloproto"
+	"github.com/lstoll/grpce/kv"
+	"github.com/lstoll/grpce/kv/s3fake"
+)
+
+func TestStorePollFunc(t *testing.T) {
+	ctx := context.Background()
+	store := kv.NewMemory()
+	for k, v := range map[string]string{
+		"services/svc/10.0.0.1:80": `{}`,
+		"services/svc/b":           `{"addr":"10.0.0.2:80","availabilityZone":"us-east-1a","weight":2}`,
+		"services/svcother/c":      `{"addr":"10.0.0.3:80"}`,
+	} {
+		if _, err := store.Put(ctx, k, []byte(v), kv.Precondition{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	eps, err := StorePollFunc(store, "services/")(ctx, "svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(eps) != 2 {
+		t.Fatalf("want 2 endpoints, got %+v", eps)
+	}
+	if eps[0].Addr != "10.0.0.1:80" {
+		t.Errorf("want address from key, got %q", eps[0].Addr)
+	}
+	if eps[1].Addr != "10.0.0.2:80" || eps[1].AvailabilityZone != "us-east-1a" || eps[1].Weight != 2 {
+		t.Errorf("Unexpected endpoint %+v", eps[1])
+	}
+
+	if _, err := store.Put(ctx, "services/svc/bad", []byte("not json"), kv.Precondition{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := StorePollFunc(store, "services/")(ctx, "svc"); err == nil {
+		t.Error("want error for an unparseable endpoint")
+	}
+}
+
+func TestS3EndToEnd(t *testing.T) {
+	fake := s3fake.New(s3fake.WithBucket("discovery"), s3fake.WithListLag(20*time.Millisecond))
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	store, err := kv.NewS3(kv.S3Config{
+		Endpoint:        srv.URL,
+		Region:          "us-east-1",
+		Bucket:          "discovery",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for _, n := range []string{"1", "2"} {
+		lis, err := net.Listen("tcp", "localhost:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := grpc.NewServer()
+		helloproto.RegisterHelloServer(s, &helloproto.TestHelloServer{ServerName: n})
+		go s.Serve(lis)
+		defer s.Stop()
+
+		ep, _ := json.Marshal(Endpoint{Addr: lis.Addr().String()})
+		if _, err := store.Put(ctx, "services/hello/"+n, ep, kv.Precondition{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := NewContextBuilder(5*time.Millisecond, StorePollFunc(store, "services/"),
+		WithScheme("kvs3test"),
+		WithServiceConfig(`{"loadBalancingPolicy":"round_robin"}`),
+		WithErrorReporter(&errprint{}),
+	)
+	resolver.Register(b)
+	defer resolver.UnregisterForTesting(b.Scheme())
+
+	conn, err := grpc.Dial("kvs3test:///hello", grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := helloproto.NewHelloClient(conn)
+
+	// The listing lags, so wait for both servers to be picked up.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		seen := map[string]struct{}{}
+		for i := 0; i < 4; i++ {
+			resp, err := c.HelloWorld(ctx, &helloproto.HelloRequest{}, grpc.FailFast(false))
+			if err != nil {
+				t.Fatalf("Error calling RPC: %q", err)
+			}
+			seen[resp.ServerName] = struct{}{}
+		}
+		if len(seen) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected requests to be balanced over both servers, saw %v", seen)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,366 @@
+package kvresolver
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/lstoll/grpce/reporters"
+)
+
+// watcher runs the poll loop for a single target. Every successful poll hands
+// the full endpoint set to update, leaving it to the caller to translate that
+// in to whatever the grpc API it is serving expects.
+type watcher struct {
+	target       string
+	pollFunc     ViewPollFunc
+	pollInterval time.Duration
+	opts         *kvrOptions
+	update       func(endpoints []Endpoint)
+
+	resolveNow chan struct{}
+
+	// cached is the set last written to the cache file.
+	cached []Endpoint
+	// seeded is set while the endpoints are those loaded from the cache file,
+	// before any poll has been applied.
+	seeded bool
+	// absent and pending track flapping endpoints for damping.
+	absent  map[string]*absence
+	pending map[string]int
+	// generation is the highest generation of an applied view, and
+	// generations the newest seen for each known endpoint.
+	generation  uint64
+	generations map[string]uint64
+	// guardTrips is the number of consecutive polls the removal guard has
+	// suppressed.
+	guardTrips int
+
+	// statusMu guards the fields below, which are read by Statuses. They are
+	// only written by the poll loop, so it can read them without locking.
+	statusMu sync.Mutex
+	// lastPoll is when the last poll completed, and lastErr it's error.
+	lastPoll time.Time
+	lastErr  error
+	// failures is the number of consecutive failed polls.
+	failures int
+	// lastSuccess is when we last successfully polled, or when the watcher was
+	// created if we never have.
+	lastSuccess time.Time
+	// stale is set once lastSuccess is older than the stale threshold.
+	stale bool
+	// endpoints is the set last passed to update.
+	endpoints []Endpoint
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	// exited is closed when run returns.
+	exited chan struct{}
+}
+
+func newWatcher(target string, pollInterval time.Duration, pollFunc ViewPollFunc, opts *kvrOptions, update func(endpoints []Endpoint)) *watcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &watcher{
+		target:       target,
+		pollFunc:     pollFunc,
+		pollInterval: pollInterval,
+		opts:         opts,
+		update:       update,
+		resolveNow:   make(chan struct{}, 1),
+		lastSuccess:  time.Now(),
+		ctx:          ctx,
+		cancel:       cancel,
+		exited:       make(chan struct{}),
+	}
+}
+
+// poll calls the poll function once, reporting any error. If the watcher is
+// closed while the poll is in flight it's context is cancelled, and it's
+// result discarded.
+func (w *watcher) poll() error {
+	ctx := w.ctx
+	if w.opts.pollTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.opts.pollTimeout)
+		defer cancel()
+	}
+
+	type result struct {
+		view View
+		err  error
+	}
+	// Buffered so the poll goroutine can always exit, even if we've stopped
+	// waiting on it.
+	resC := make(chan result, 1)
+	start := time.Now()
+	go func() {
+		view, err := w.pollFunc(ctx, w.target)
+		resC <- result{view: view, err: err}
+	}()
+
+	var res result
+	select {
+	case res = <-resC:
+	case <-ctx.Done():
+		res.err = ctx.Err()
+	}
+	if w.ctx.Err() != nil {
+		// Closed, nothing to report.
+		return w.ctx.Err()
+	}
+	reporters.ReportTiming(w.opts.metricsReporter, w.metricKey("poll.latency"), time.Since(start))
+	if res.err != nil {
+		reporters.ReportError(w.opts.errorReporter, res.err)
+		reporters.ReportCount(w.opts.metricsReporter, "kvresolver.pollfunc.errors", 1)
+		return res.err
+	}
+	if res.view.Generation != 0 && res.view.Generation < w.generation {
+		// An older view of an eventually consistent store, ignore it.
+		reporters.ReportCount(w.opts.metricsReporter, "kvresolver.generation.rejected", 1)
+		return nil
+	}
+	if res.view.Generation > w.generation {
+		// Unversioned views leave the generation alone, so they don't reopen
+		// rollback to older versioned ones.
+		w.generation = res.view.Generation
+	}
+	w.apply(w.latestRecords(res.view.Endpoints))
+	w.pruneGenerations(res.view.Endpoints)
+	return nil
+}
+
+// pruneGenerations forgets endpoints that are neither in the polled set nor
+// being served, so generations doesn't grow as servers come and go.
+func (w *watcher) pruneGenerations(polled []Endpoint) {
+	if len(w.generations) == 0 {
+		return
+	}
+	keep := map[string]bool{}
+	for _, e := range polled {
+		keep[e.Addr] = true
+	}
+	for _, e := range w.endpoints {
+		keep[e.Addr] = true
+	}
+	for addr := range w.generations {
+		if !keep[addr] {
+			delete(w.generations, addr)
+		}
+	}
+}
+
+// latestRecords replaces any endpoint records older than ones already applied
+// with the applied record, and tracks the newest generation seen for each
+// endpoint.
+func (w *watcher) latestRecords(endpoints []Endpoint) []Endpoint {
+	var ret []Endpoint
+	for i, e := range endpoints {
+		if e.Generation == 0 {
+			continue
+		}
+		if w.generations == nil {
+			w.generations = map[string]uint64{}
+		}
+		if e.Generation >= w.generations[e.Addr] {
+			w.generations[e.Addr] = e.Generation
+			continue
+		}
+		for _, c := range w.endpoints {
+			if c.Addr == e.Addr && c.Generation > e.Generation {
+				if ret == nil {
+					// Don't modify the poll function's slice.
+					ret = append([]Endpoint{}, endpoints...)
+				}
+				ret[i] = c
+				reporters.ReportCount(w.opts.metricsReporter, "kvresolver.generation.rejected.endpoints", 1)
+				break
+			}
+		}
+	}
+	if ret == nil {
+		return endpoints
+	}
+	return ret
+}
+
+// apply passes a freshly polled endpoint set through the configured safety
+// checks, and if they allow it hands it to update.
+func (w *watcher) apply(endpoints []Endpoint) {
+	if w.seeded {
+		// The cached seed can be arbitrarily old, so the first poll replaces
+		// it outright rather than being damped or guarded against it.
+		w.seeded = false
+	} else {
+		endpoints = w.damp(endpoints)
+		if !w.guardAllows(endpoints) {
+			return
+		}
+	}
+	w.reportChanges(endpoints)
+	w.statusMu.Lock()
+	w.endpoints = endpoints
+	w.statusMu.Unlock()
+	w.update(endpoints)
+	w.saveCache(endpoints)
+}
+
+// metricKey returns a metric name specific to this watcher's target.
+func (w *watcher) metricKey(name string) string {
+	return "kvresolver." + name + "." + w.target
+}
+
+// reportChanges reports metrics about the move from the current endpoint set
+// to next.
+func (w *watcher) reportChanges(next []Endpoint) {
+	mr := w.opts.metricsReporter
+	if mr == nil {
+		return
+	}
+	var adds, deletes int64
+	for _, n := range next {
+		if !containsAddr(w.endpoints, n.Addr) {
+			adds++
+		}
+	}
+	for _, c := range w.endpoints {
+		if !containsAddr(next, c.Addr) {
+			deletes++
+		}
+	}
+	reporters.ReportCount(mr, "kvresolver.updates.adds", adds)
+	reporters.ReportCount(mr, "kvresolver.updates.deletes", deletes)
+	reporters.ReportGauge(mr, w.metricKey("endpoints"), int64(len(next)))
+}
+
+func containsAddr(endpoints []Endpoint, addr string) bool {
+	for _, e := range endpoints {
+		if e.Addr == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// StaleError is reported when no poll for a target has succeeded within the
+// WithStaleAfter threshold. The resolver keeps serving the last known good
+// endpoints while it is stale.
+type StaleError struct {
+	Target      string
+	LastSuccess time.Time
+}
+
+func (s *StaleError) Error() string {
+	return fmt.Sprintf("kvresolver: endpoints for %q are stale, last successful poll was at %s", s.Target, s.LastSuccess)
+}
+
+// recordResult updates the failure and staleness state after a poll.
+func (w *watcher) recordResult(err error) {
+	if w.ctx.Err() != nil {
+		// Closed mid poll, the error is ours not the poll function's.
+		return
+	}
+	now := time.Now()
+
+	w.statusMu.Lock()
+	w.lastPoll = now
+	w.lastErr = err
+	wasStale := w.stale
+	if err == nil {
+		w.failures = 0
+		w.lastSuccess = now
+		w.stale = false
+	} else {
+		w.failures++
+		if w.opts.staleAfter > 0 && now.Sub(w.lastSuccess) > w.opts.staleAfter {
+			w.stale = true
+		}
+	}
+	lastSuccess, stale := w.lastSuccess, w.stale
+	w.statusMu.Unlock()
+
+	reporters.ReportGauge(w.opts.metricsReporter, w.metricKey("lastsuccess.age"), int64(now.Sub(lastSuccess)/time.Second))
+	switch {
+	case wasStale && !stale:
+		reporters.ReportGauge(w.opts.metricsReporter, w.metricKey("stale"), 0)
+	case !wasStale && stale:
+		reporters.ReportError(w.opts.errorReporter, &StaleError{Target: w.target, LastSuccess: lastSuccess})
+		reporters.ReportCount(w.opts.metricsReporter, "kvresolver.stale.transitions", 1)
+		reporters.ReportGauge(w.opts.metricsReporter, w.metricKey("stale"), 1)
+	}
+}
+
+// nextDelay returns how long to wait before the next poll. After consecutive
+// failures the poll interval is doubled for each, up to the max backoff. The
+// result is then jittered so clients started together don't poll together.
+func (w *watcher) nextDelay() time.Duration {
+	d := w.pollInterval
+	if max := w.opts.maxBackoff; max > 0 && w.failures > 0 {
+		for i := 0; i < w.failures && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+	}
+	if j := w.opts.jitter; j > 0 {
+		d = time.Duration(float64(d) * (1 + j*(2*rand.Float64()-1)))
+	}
+	return d
+}
+
+// run polls until the watcher is closed. It should be called in it's own
+// goroutine.
+func (w *watcher) run() {
+	defer close(w.exited)
+	trackWatcher(w)
+	defer untrackWatcher(w)
+
+	// Initial seed.
+	w.loadCache()
+	w.recordResult(w.poll())
+
+	timer := time.NewTimer(w.nextDelay())
+	defer timer.Stop()
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-timer.C:
+		case <-w.resolveNow:
+			if w.failures > 0 {
+				// We're backing off, don't let grpc's reconnect attempts
+				// hammer a failing KV store.
+				continue
+			}
+			if !timer.Stop() {
+				<-timer.C
+			}
+		}
+		w.recordResult(w.poll())
+		timer.Reset(w.nextDelay())
+	}
+}
+
+// triggerPoll asks the loop to poll as soon as possible. Multiple calls before
+// the loop gets to it are collapsed in to a single poll.
+func (w *watcher) triggerPoll() {
+	select {
+	case w.resolveNow <- struct{}{}:
+	default:
+	}
+}
+
+// done returns a channel that is closed when the watcher is closed. update
+// functions that may block should give up when it's closed.
+func (w *watcher) done() <-chan struct{} {
+	return w.ctx.Done()
+}
+
+// close cancels any in-flight poll, and blocks until the poll loop has
+// exited. It is safe to call multiple times.
+func (w *watcher) close() {
+	w.cancel()
+	<-w.exited
+}
@@ -0,0 +1,347 @@
+package kvresolver
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+
+	"github.com/lstoll/grpce/reporters/reporterstest"
+)
+
+// waitForGoroutines waits for the number of running goroutines to drop to
+// want, failing the test if it doesn't.
+func waitForGoroutines(t *testing.T, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		n := runtime.NumGoroutine()
+		if n <= want {
+			return
+		}
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("want at most %d goroutines, have %d:\n%s", want, n, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCloseCancelsInFlightPoll(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	lookup := func(ctx context.Context, target string) ([]Endpoint, error) {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	}
+
+	ec := &reporterstest.ErrorCollector{}
+	cc := &recordingClientConn{states: make(chan resolver.State, 1)}
+	r, err := NewContextBuilder(time.Hour, lookup, WithErrorReporter(ec)).Build(resolver.Target{Endpoint: "svc"}, cc, resolver.BuildOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-started
+	r.Close()
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("Close did not cancel the in-flight poll")
+	}
+	if errs := ec.Errors(); len(errs) != 0 {
+		t.Errorf("want no errors reported for a closed poll, got %v", errs)
+	}
+	waitForGoroutines(t, before)
+}
+
+func TestPollTimeout(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+	lookup := func(ctx context.Context, target string) ([]Endpoint, error) {
+		mu.Lock()
+		calls++
+		first := calls == 1
+		mu.Unlock()
+		if first {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return []Endpoint{{Addr: "a:1"}}, nil
+	}
+
+	ec := &reporterstest.ErrorCollector{}
+	cc := &recordingClientConn{states: make(chan resolver.State, 10)}
+	r, err := NewContextBuilder(10*time.Millisecond, lookup,
+		WithPollTimeout(5*time.Millisecond),
+		WithErrorReporter(ec),
+	).Build(resolver.Target{Endpoint: "svc"}, cc, resolver.BuildOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case s := <-cc.states:
+		if len(s.Addresses) != 1 {
+			t.Errorf("want 1 address, got %d", len(s.Addresses))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for a poll after the timed out one")
+	}
+	r.Close()
+
+	errs := ec.Errors()
+	if len(errs) != 1 || errs[0] != context.DeadlineExceeded {
+		t.Errorf("want a single deadline exceeded error, got %v", errs)
+	}
+	waitForGoroutines(t, before)
+}
+
+func TestNamingCloseWithPendingUpdate(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	lookup := func(target string) ([]string, error) {
+		return []string{"a:1"}, nil
+	}
+
+	w, err := New("svc", time.Millisecond, lookup).Resolve("svc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Next(); err != nil {
+		t.Fatal(err)
+	}
+	// Let the loop block trying to send the next update, nobody is reading it.
+	time.Sleep(10 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		w.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close blocked")
+	}
+	if _, err := w.Next(); err == nil {
+		t.Error("want error from Next on a closed watcher")
+	}
+	waitForGoroutines(t, before)
+}
+
+type metricsrecorder struct {
+	mu     sync.Mutex
+	counts map[string]int64
+	gauges map[string]int64
+}
+
+func newMetricsRecorder() *metricsrecorder {
+	return &metricsrecorder{counts: map[string]int64{}, gauges: map[string]int64{}}
+}
+
+func (m *metricsrecorder) Count(key string, by int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counts[key] += by
+}
+
+func (m *metricsrecorder) Gauge(key string, val int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gauges[key] = val
+}
+
+func (m *metricsrecorder) count(key string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counts[key]
+}
+
+func (m *metricsrecorder) gauge(key string) (int64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.gauges[key]
+	return v, ok
+}
+
+func TestNextDelay(t *testing.T) {
+	w := newWatcher("svc", 10*time.Second, nil, &kvrOptions{maxBackoff: time.Minute}, nil)
+
+	for _, tc := range []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 10 * time.Second},
+		{1, 20 * time.Second},
+		{2, 40 * time.Second},
+		{3, time.Minute},
+		{100, time.Minute},
+	} {
+		w.failures = tc.failures
+		if got := w.nextDelay(); got != tc.want {
+			t.Errorf("%d failures: want delay %s, got %s", tc.failures, tc.want, got)
+		}
+	}
+
+	w.failures = 0
+	w.opts.jitter = 0.1
+	var varied bool
+	for i := 0; i < 100; i++ {
+		d := w.nextDelay()
+		if d < 9*time.Second || d > 11*time.Second {
+			t.Fatalf("Jittered delay %s outside of 10%% range", d)
+		}
+		if d != 10*time.Second {
+			varied = true
+		}
+	}
+	if !varied {
+		t.Error("Jitter never changed the delay")
+	}
+}
+
+func TestStaleEndpointsKeepServing(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		failing bool
+	)
+	lookup := func(target string) ([]Endpoint, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failing {
+			return nil, errors.New("KV unavailable")
+		}
+		return []Endpoint{{Addr: "a:1"}}, nil
+	}
+
+	ec := &reporterstest.ErrorCollector{}
+	mr := newMetricsRecorder()
+	cc := &recordingClientConn{states: make(chan resolver.State, 100)}
+	r, err := NewEndpointBuilder(time.Millisecond, lookup,
+		WithStaleAfter(20*time.Millisecond),
+		WithErrorReporter(ec),
+		WithMetricsReporter(mr),
+	).Build(resolver.Target{Endpoint: "svc"}, cc, resolver.BuildOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	<-cc.states
+	mu.Lock()
+	failing = true
+	mu.Unlock()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if v, _ := mr.gauge("kvresolver.stale.svc"); v == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Endpoints never marked stale")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	var stale int
+	for _, err := range ec.Errors() {
+		if se, ok := err.(*StaleError); ok {
+			stale++
+			if se.Target != "svc" {
+				t.Errorf("want stale target %q, got %q", "svc", se.Target)
+			}
+		}
+	}
+	if stale != 1 {
+		t.Errorf("want 1 stale error, got %d", stale)
+	}
+	if c := mr.count("kvresolver.stale.transitions"); c != 1 {
+		t.Errorf("want 1 stale transition, got %d", c)
+	}
+
+	// Errors should never have pushed an empty list.
+	for len(cc.states) > 0 {
+		if s := <-cc.states; len(s.Addresses) == 0 {
+			t.Error("Failed poll cleared the address list")
+		}
+	}
+
+	mu.Lock()
+	failing = false
+	mu.Unlock()
+	deadline = time.Now().Add(2 * time.Second)
+	for {
+		if v, _ := mr.gauge("kvresolver.stale.svc"); v == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Endpoints never marked fresh")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPollMetrics(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		addrs = []string{"a:1", "b:1"}
+	)
+	lookup := func(target string) ([]string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return addrs, nil
+	}
+
+	mr := newMetricsRecorder()
+	cc := &recordingClientConn{states: make(chan resolver.State, 1)}
+	r, err := NewBuilder(time.Hour, lookup, WithMetricsReporter(mr)).Build(resolver.Target{Endpoint: "svc"}, cc, resolver.BuildOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	<-cc.states
+
+	mu.Lock()
+	addrs = []string{"b:1", "c:1", "d:1"}
+	mu.Unlock()
+	r.ResolveNow(resolver.ResolveNowOption{})
+	<-cc.states
+
+	if v, _ := mr.gauge("kvresolver.endpoints.svc"); v != 3 {
+		t.Errorf("want endpoint gauge of 3, got %d", v)
+	}
+	if c := mr.count("kvresolver.updates.adds"); c != 4 {
+		t.Errorf("want 4 adds, got %d", c)
+	}
+	if c := mr.count("kvresolver.updates.deletes"); c != 1 {
+		t.Errorf("want 1 delete, got %d", c)
+	}
+	if _, ok := mr.gauge("kvresolver.poll.latency.svc"); !ok {
+		t.Error("Poll latency not reported")
+	}
+	// The age is reported after the update is pushed, so wait for it.
+	deadline := time.Now().Add(time.Second)
+	for {
+		if v, ok := mr.gauge("kvresolver.lastsuccess.age.svc"); ok && v == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Last success age not reported")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
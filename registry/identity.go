@@ -0,0 +1,115 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/lstoll/grpce/identitydoc"
+)
+
+// IdentityError is reported when an entry is rejected by identity
+// verification.
+type IdentityError struct {
+	Key    string
+	Addr   string
+	Reason string
+}
+
+func (i *IdentityError) Error() string {
+	return fmt.Sprintf("registry: rejected entry %s for %s: %s", i.Key, i.Addr, i.Reason)
+}
+
+type identityPolicy struct {
+	accounts map[string]bool
+	regions  map[string]bool
+}
+
+// WithIdentityVerification only accepts entries carrying a valid instance
+// identity document, for an instance in one of accounts and regions, whose
+// private IP and instance ID are the entry's address and InstanceID. This
+// stops anyone who can write to the registry pointing clients at an address
+// they don't control. An empty list allows any account or region, but
+// accounts should always be restricted.
+//
+// The document is signed by AWS, not the instance, so it can't cover the
+// entry's Certificates. Anyone who can read an entry and write to the
+// registry can copy the document and signature in to an entry for the same
+// instance, carrying certificates of their own. It proves where the server
+// is, not that the published certificates are it's, so access to write the
+// registry still needs to be restricted to the servers.
+func WithIdentityVerification(accounts, regions []string) Option {
+	return func(o *options) {
+		p := &identityPolicy{}
+		if len(accounts) > 0 {
+			p.accounts = map[string]bool{}
+			for _, a := range accounts {
+				p.accounts[a] = true
+			}
+		}
+		if len(regions) > 0 {
+			p.regions = map[string]bool{}
+			for _, r := range regions {
+				p.regions[r] = true
+			}
+		}
+		o.identity = p
+	}
+}
+
+// WithIdentityVerifier sets the verifier identity documents are checked with,
+// in place of identitydoc.DefaultVerifier. It has no effect without
+// WithIdentityVerification.
+func WithIdentityVerifier(v *identitydoc.Verifier) Option {
+	return func(o *options) {
+		o.identityVerifier = v
+	}
+}
+
+// verify checks the entry stored at key against the policy, using v. A nil
+// policy accepts everything.
+func (p *identityPolicy) verify(v *identitydoc.Verifier, key string, e Entry) error {
+	if p == nil {
+		return nil
+	}
+	reject := func(reason string) error {
+		return &IdentityError{Key: key, Addr: e.Addr, Reason: reason}
+	}
+	if len(e.IdentityDocument) == 0 || e.IdentitySignature == "" {
+		return reject("no identity document")
+	}
+
+	// Check the region is one we allow before trusting the signature for
+	// it.
+	var claimed struct {
+		Region string `json:"region"`
+	}
+	if err := json.Unmarshal(e.IdentityDocument, &claimed); err != nil {
+		return reject("malformed identity document")
+	}
+	if p.regions != nil && !p.regions[claimed.Region] {
+		return reject("region " + claimed.Region + " not allowed")
+	}
+	if v == nil {
+		v = identitydoc.DefaultVerifier
+	}
+	doc, err := v.VerifyDocumentAndSignature(claimed.Region, e.IdentityDocument, []byte(e.IdentitySignature))
+	if err != nil {
+		return reject("identity document not verified: " + err.Error())
+	}
+
+	if p.accounts != nil && !p.accounts[doc.AccountID] {
+		return reject("account " + doc.AccountID + " not allowed")
+	}
+	if e.InstanceID != doc.InstanceID {
+		return reject("instance does not match document instance " + doc.InstanceID)
+	}
+	host, _, err := net.SplitHostPort(e.Addr)
+	if err != nil {
+		return reject(err.Error())
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.Equal(net.ParseIP(doc.PrivateIP)) {
+		return reject("address does not match instance private IP " + doc.PrivateIP)
+	}
+	return nil
+}
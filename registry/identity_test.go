@@ -0,0 +1,160 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lstoll/grpce/identitydoc"
+	"github.com/lstoll/grpce/identitydoc/identitydoctest"
+	"github.com/lstoll/grpce/kv"
+	"github.com/lstoll/grpce/kvresolver"
+	"github.com/lstoll/grpce/reporters/reporterstest"
+)
+
+func TestIdentityVerification(t *testing.T) {
+	ctx := context.Background()
+	s := identitydoctest.NewSigner()
+	testDoc := identitydoctest.AWSDocument
+	testSig := string(s.Sign([]byte(testDoc)))
+
+	for _, tc := range []struct {
+		name     string
+		entry    Entry
+		accounts []string
+		regions  []string
+		// now is the verifier's time, if not the current time.
+		now    time.Time
+		reason string
+	}{
+		{
+			name:     "valid",
+			entry:    Entry{Endpoint: kvresolver.Endpoint{Addr: "172.30.0.208:443"}, IdentityDocument: []byte(testDoc), IdentitySignature: testSig},
+			accounts: []string{"021124591875"},
+			regions:  []string{"us-east-1"},
+		},
+		{
+			name:   "no document",
+			entry:  Entry{Endpoint: kvresolver.Endpoint{Addr: "172.30.0.208:443"}},
+			reason: "no identity document",
+		},
+		{
+			name:   "wrong address",
+			entry:  Entry{Endpoint: kvresolver.Endpoint{Addr: "10.0.0.1:443"}, IdentityDocument: []byte(testDoc), IdentitySignature: testSig},
+			reason: "address does not match",
+		},
+		{
+			name:     "wrong account",
+			entry:    Entry{Endpoint: kvresolver.Endpoint{Addr: "172.30.0.208:443"}, IdentityDocument: []byte(testDoc), IdentitySignature: testSig},
+			accounts: []string{"123456789012"},
+			reason:   "account 021124591875 not allowed",
+		},
+		{
+			name:    "wrong region",
+			entry:   Entry{Endpoint: kvresolver.Endpoint{Addr: "172.30.0.208:443"}, IdentityDocument: []byte(testDoc), IdentitySignature: testSig},
+			regions: []string{"eu-west-1"},
+			reason:  "region us-east-1 not allowed",
+		},
+		{
+			name:   "tampered",
+			entry:  Entry{Endpoint: kvresolver.Endpoint{Addr: "10.0.0.1:443"}, IdentityDocument: []byte(strings.Replace(testDoc, "172.30.0.208", "10.0.0.1", 1)), IdentitySignature: testSig},
+			reason: "not verified",
+		},
+		{
+			name:   "wrong instance",
+			entry:  Entry{Endpoint: kvresolver.Endpoint{Addr: "172.30.0.208:443"}, InstanceID: "i-00000000", IdentityDocument: []byte(testDoc), IdentitySignature: testSig},
+			reason: "instance does not match",
+		},
+		{
+			name:   "expired certificate",
+			entry:  Entry{Endpoint: kvresolver.Endpoint{Addr: "172.30.0.208:443"}, IdentityDocument: []byte(testDoc), IdentitySignature: testSig},
+			now:    time.Now().Add(48 * time.Hour),
+			reason: "not verified",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := kv.NewMemory()
+			if tc.entry.InstanceID == "" {
+				tc.entry.InstanceID = "i-1ddaabe5"
+			}
+			tc.entry.Heartbeat = time.Now()
+			b, _ := json.Marshal(&tc.entry)
+			if _, err := store.Put(ctx, Key(DefaultPrefix, "hello", "i-1ddaabe5"), b, kv.Precondition{}); err != nil {
+				t.Fatal(err)
+			}
+
+			v := s.Verifier()
+			if !tc.now.IsZero() {
+				v.SetClock(func() time.Time { return tc.now })
+			}
+			ec := &reporterstest.ErrorCollector{}
+			entries, err := Entries(ctx, store, DefaultPrefix, "hello", time.Minute,
+				WithIdentityVerification(tc.accounts, tc.regions),
+				WithIdentityVerifier(v),
+				WithErrorReporter(ec),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.reason == "" {
+				if len(entries) != 1 || len(ec.Errors()) != 0 {
+					t.Errorf("want entry accepted, got %v %v", entries, ec.Errors())
+				}
+				return
+			}
+			if len(entries) != 0 {
+				t.Errorf("want entry rejected, got %v", entries)
+			}
+			if len(ec.Errors()) != 1 {
+				t.Fatalf("want 1 error reported, got %v", ec.Errors())
+			}
+			ie, ok := ec.Errors()[0].(*IdentityError)
+			if !ok || !strings.Contains(ie.Reason, tc.reason) {
+				t.Errorf("want rejection for %q, got %v", tc.reason, ec.Errors()[0])
+			}
+		})
+	}
+}
+
+func TestIdentityVerifier(t *testing.T) {
+	ctx := context.Background()
+	s := identitydoctest.NewSigner()
+	doc := identitydoctest.Document(identitydoc.InstanceIdentityDocument{
+		InstanceID: "i-1234",
+		AccountID:  "123456789012",
+		PrivateIP:  "10.0.0.1",
+		Region:     "eu-west-1",
+	})
+	store := kv.NewMemory()
+	r, err := Register(ctx, store, "hello", Entry{
+		Endpoint:          kvresolver.Endpoint{Addr: "10.0.0.1:443"},
+		IdentityDocument:  doc,
+		IdentitySignature: string(s.Sign(doc)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if r.Key() != "services/hello/i-1234" {
+		t.Errorf("want the document's instance ID used for missing instance ID, got key %q", r.Key())
+	}
+
+	policy := WithIdentityVerification([]string{"123456789012"}, nil)
+	entries, err := Entries(ctx, store, DefaultPrefix, "hello", time.Minute, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("want entry rejected by the default verifier, got %v", entries)
+	}
+
+	entries, err = Entries(ctx, store, DefaultPrefix, "hello", time.Minute, policy, WithIdentityVerifier(s.Verifier()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("want entry accepted by the signer's verifier, got %v", entries)
+	}
+}
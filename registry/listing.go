@@ -0,0 +1,80 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/lstoll/grpce/kv"
+	"github.com/lstoll/grpce/kvresolver"
+)
+
+// Listing is an aggregate record of all of a service's endpoints, stored in a
+// single object. It's an alternative to per-server entries for services whose
+// membership is managed centrally, e.g by a deploy tool. Every write increases
+// the generation, so clients can tell an older listing from a newer one.
+type Listing struct {
+	Generation uint64                `json:"generation"`
+	Endpoints  []kvresolver.Endpoint `json:"endpoints"`
+}
+
+// ListingKey returns the key the listing for service is stored under.
+func ListingKey(prefix, service string) string {
+	return prefix + service + ".json"
+}
+
+// WriteListing replaces the listing for service with endpoints, returning the
+// listing as written. The generation is advanced from the stored listing's,
+// and the write is conditional on it not having changed since it was read, so
+// concurrent writers can't reuse a generation. On a conflict
+// kv.ErrPreconditionFailed is returned, and the caller should retry.
+func WriteListing(ctx context.Context, store kv.Store, prefix, service string, endpoints []kvresolver.Endpoint) (*Listing, error) {
+	key := ListingKey(prefix, service)
+
+	var (
+		prev Listing
+		pre  kv.Precondition
+	)
+	o, err := store.Get(ctx, key)
+	switch err {
+	case nil:
+		if err := json.Unmarshal(o.Value, &prev); err != nil {
+			return nil, err
+		}
+		pre.IfMatch = o.ETag
+	case kv.ErrNotFound:
+		pre.IfNoneMatch = "*"
+	default:
+		return nil, err
+	}
+
+	l := &Listing{
+		Generation: nextGeneration(prev.Generation),
+		Endpoints:  endpoints,
+	}
+	b, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := store.Put(ctx, key, b, pre); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// ListingPollFunc returns a kvresolver poll function that reads the listing
+// for a target service. It should be used with kvresolver.NewViewBuilder, so
+// that listings older than one already applied are rejected. A missing listing
+// is treated as an error, rather than an empty service.
+func ListingPollFunc(store kv.Store, prefix string) kvresolver.ViewPollFunc {
+	return func(ctx context.Context, target string) (kvresolver.View, error) {
+		o, err := store.Get(ctx, ListingKey(prefix, target))
+		if err != nil {
+			return kvresolver.View{}, err
+		}
+		var l Listing
+		if err := json.Unmarshal(o.Value, &l); err != nil {
+			return kvresolver.View{}, err
+		}
+		return kvresolver.View{Generation: l.Generation, Endpoints: l.Endpoints}, nil
+	}
+}
@@ -0,0 +1,49 @@
+package registry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lstoll/grpce/kv"
+	"github.com/lstoll/grpce/kvresolver"
+)
+
+func TestListing(t *testing.T) {
+	ctx := context.Background()
+	store := kv.NewMemory()
+	poll := ListingPollFunc(store, DefaultPrefix)
+
+	if _, err := poll(ctx, "hello"); err != kv.ErrNotFound {
+		t.Errorf("want not found for a missing listing, got %v", err)
+	}
+
+	l1, err := WriteListing(ctx, store, DefaultPrefix, "hello", []kvresolver.Endpoint{{Addr: "a:1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2, err := WriteListing(ctx, store, DefaultPrefix, "hello", []kvresolver.Endpoint{{Addr: "a:1"}, {Addr: "b:1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l2.Generation <= l1.Generation {
+		t.Errorf("want generation to increase, got %d then %d", l1.Generation, l2.Generation)
+	}
+
+	v, err := poll(ctx, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Generation != l2.Generation || len(v.Endpoints) != 2 {
+		t.Errorf("Unexpected view %+v", v)
+	}
+}
+
+func TestNextGeneration(t *testing.T) {
+	far := uint64(1) << 62
+	if g := nextGeneration(far); g != far+1 {
+		t.Errorf("want %d for a generation ahead of the clock, got %d", far+1, g)
+	}
+	if g := nextGeneration(0); g == 0 {
+		t.Error("want a non-zero generation")
+	}
+}
@@ -0,0 +1,317 @@
+// Package registry lets servers announce themselves in a KV store, and lets
+// clients discover them with kvresolver.
+//
+// Each server writes an Entry under <prefix><service>/<instance ID>, and
+// refreshes it's heartbeat periodically. The poll function returned by
+// PollFunc ignores entries whose heartbeat is older than a TTL, so servers that
+// die without deregistering drop out on their own. Nothing relies on the store
+// being strongly consistent: listings that lag writes only delay discovery,
+// and entries that vanish between being listed and read are skipped.
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lstoll/grpce/identitydoc"
+	"github.com/lstoll/grpce/kv"
+	"github.com/lstoll/grpce/kvresolver"
+	"github.com/lstoll/grpce/reporters"
+)
+
+// DefaultPrefix is the prefix entries are stored under if none is given.
+const DefaultPrefix = "services/"
+
+// DefaultHeartbeatInterval is how often entries are refreshed if no interval
+// is given.
+const DefaultHeartbeatInterval = 30 * time.Second
+
+// Entry is a server's registration record. The endpoint fields are stored
+// inline, so entries can also be read by kvresolver.StorePollFunc.
+type Entry struct {
+	kvresolver.Endpoint
+	// InstanceID uniquely identifies the server within the service.
+	InstanceID string `json:"instanceId"`
+	// Heartbeat is when the entry was last refreshed.
+	Heartbeat time.Time `json:"heartbeat"`
+	// Certificates are the PEM encoded certificates the server presents, for
+	// clients to pin. There can be more than one while keys are rotated.
+	Certificates []string `json:"certificates,omitempty"`
+	// IdentityDocument and IdentitySignature are the server's instance
+	// identity document and signature, exactly as returned by the metadata
+	// server. They let clients verify the entry's address and InstanceID
+	// belong to the instance, see WithIdentityVerification. They don't cover
+	// Certificates.
+	IdentityDocument  []byte `json:"identityDocument,omitempty"`
+	IdentitySignature string `json:"identitySignature,omitempty"`
+}
+
+// Key returns the key entries for the service's instance are stored under.
+func Key(prefix, service, instanceID string) string {
+	return prefix + service + "/" + instanceID
+}
+
+type options struct {
+	prefix            string
+	heartbeatInterval time.Duration
+	errorReporter     reporters.ErrorReporter
+	metricsReporter   reporters.MetricsReporter
+	identity          *identityPolicy
+	identityVerifier  *identitydoc.Verifier
+}
+
+// Option configures a Registration.
+type Option func(*options)
+
+// WithPrefix sets the prefix entries are stored under.
+func WithPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+// WithHeartbeatInterval sets how often the entry is refreshed. It must be
+// positive.
+func WithHeartbeatInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.heartbeatInterval = d
+	}
+}
+
+// WithErrorReporter reports failed heartbeats, and entries rejected when
+// reading.
+func WithErrorReporter(er reporters.ErrorReporter) Option {
+	return func(o *options) {
+		o.errorReporter = er
+	}
+}
+
+// WithMetricsReporter counts heartbeats and their failures, and entries
+// rejected when reading.
+func WithMetricsReporter(mr reporters.MetricsReporter) Option {
+	return func(o *options) {
+		o.metricsReporter = mr
+	}
+}
+
+// Registration is a server's live entry in the registry.
+type Registration struct {
+	store   kv.Store
+	key     string
+	opts    *options
+	entryMu sync.Mutex
+	entry   Entry
+
+	cancel context.CancelFunc
+	exited chan struct{}
+	once   sync.Once
+}
+
+// Register writes entry for service to the store, and starts refreshing it's
+// heartbeat in the background. If the entry has no InstanceID, the instance ID
+// from it's identity document is used, or without one it's Addr. The initial
+// write must succeed, failed heartbeats are reported and retried on the next
+// interval.
+func Register(ctx context.Context, store kv.Store, service string, entry Entry, opts ...Option) (*Registration, error) {
+	o := &options{
+		prefix:            DefaultPrefix,
+		heartbeatInterval: DefaultHeartbeatInterval,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if entry.Addr == "" {
+		return nil, errors.New("registry: entry has no address")
+	}
+	if o.heartbeatInterval <= 0 {
+		return nil, errors.New("registry: heartbeat interval must be positive")
+	}
+	if entry.InstanceID == "" && len(entry.IdentityDocument) > 0 {
+		var doc struct {
+			InstanceID string `json:"instanceId"`
+		}
+		if err := json.Unmarshal(entry.IdentityDocument, &doc); err != nil {
+			return nil, fmt.Errorf("registry: malformed identity document: %v", err)
+		}
+		entry.InstanceID = doc.InstanceID
+	}
+	if entry.InstanceID == "" {
+		entry.InstanceID = entry.Addr
+	}
+
+	r := &Registration{
+		store:  store,
+		key:    Key(o.prefix, service, entry.InstanceID),
+		opts:   o,
+		entry:  entry,
+		exited: make(chan struct{}),
+	}
+	if err := r.heartbeat(ctx); err != nil {
+		return nil, err
+	}
+
+	hbCtx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	go r.run(hbCtx)
+	return r, nil
+}
+
+// Key returns the key the entry is stored under.
+func (r *Registration) Key() string {
+	return r.key
+}
+
+// Update applies fn to the entry, and writes it immediately rather than
+// waiting for the next heartbeat. The address and instance ID can't be
+// changed, as they determine where the entry is stored.
+func (r *Registration) Update(ctx context.Context, fn func(e *Entry)) error {
+	r.entryMu.Lock()
+	addr, id := r.entry.Addr, r.entry.InstanceID
+	fn(&r.entry)
+	r.entry.Addr, r.entry.InstanceID = addr, id
+	r.entryMu.Unlock()
+	// Another heartbeat may slip in first, but it will write the updated
+	// entry too.
+	return r.heartbeat(ctx)
+}
+
+// heartbeat writes the entry with the current time. The lock is held for the
+// write, so an update can't be overwritten by an older heartbeat.
+func (r *Registration) heartbeat(ctx context.Context) error {
+	r.entryMu.Lock()
+	defer r.entryMu.Unlock()
+	r.entry.Heartbeat = time.Now().UTC()
+	r.entry.Generation = nextGeneration(r.entry.Generation)
+	b, err := json.Marshal(&r.entry)
+	if err != nil {
+		return err
+	}
+	_, err = r.store.Put(ctx, r.key, b, kv.Precondition{})
+	return err
+}
+
+// nextGeneration returns a generation greater than prev. It's based on the
+// clock, so a restarted server's entries still supersede it's old ones.
+func nextGeneration(prev uint64) uint64 {
+	g := uint64(time.Now().UnixNano())
+	if g <= prev {
+		g = prev + 1
+	}
+	return g
+}
+
+func (r *Registration) run(ctx context.Context) {
+	defer close(r.exited)
+	ticker := time.NewTicker(r.opts.heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.heartbeat(ctx); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				reporters.ReportError(r.opts.errorReporter, err)
+				reporters.ReportCount(r.opts.metricsReporter, "registry.heartbeat.errors", 1)
+				continue
+			}
+			reporters.ReportCount(r.opts.metricsReporter, "registry.heartbeats", 1)
+		}
+	}
+}
+
+// Stop stops heartbeating without removing the entry, which will expire once
+// it's TTL passes. It is safe to call multiple times.
+func (r *Registration) Stop() {
+	r.once.Do(func() {
+		r.cancel()
+		<-r.exited
+	})
+}
+
+// Deregister stops heartbeating and removes the entry. It should be called on
+// graceful shutdown, before the server stops accepting connections.
+func (r *Registration) Deregister(ctx context.Context) error {
+	r.Stop()
+	return r.store.Delete(ctx, r.key, kv.Precondition{})
+}
+
+// Entries reads the live entries for a service from the store, ignoring those
+// with a heartbeat older than ttl. They are ordered by key. Of the options,
+// the identity verification options and the reporters apply.
+func Entries(ctx context.Context, store kv.Store, prefix, service string, ttl time.Duration, opts ...Option) ([]Entry, error) {
+	eo := &options{}
+	for _, opt := range opts {
+		opt(eo)
+	}
+
+	infos, err := store.List(ctx, prefix+service+"/")
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	entries := make([]Entry, 0, len(infos))
+	for _, info := range infos {
+		// Every heartbeat rewrites the object, so if it hasn't been modified
+		// within the TTL neither has the heartbeat. Skip the read.
+		if !info.LastModified.IsZero() && now.Sub(info.LastModified) > ttl {
+			continue
+		}
+		o, err := store.Get(ctx, info.Key)
+		if err == kv.ErrNotFound {
+			// Deregistered since the listing.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var e Entry
+		if err := json.Unmarshal(o.Value, &e); err != nil {
+			// Not a registration record, skip it rather than failing
+			// discovery for the whole service.
+			reporters.ReportError(eo.errorReporter, fmt.Errorf("registry: malformed entry %s: %v", info.Key, err))
+			reporters.ReportCount(eo.metricsReporter, "registry.entries.malformed", 1)
+			continue
+		}
+		if e.Addr == "" || now.Sub(e.Heartbeat) > ttl {
+			continue
+		}
+		if err := eo.identity.verify(eo.identityVerifier, info.Key, e); err != nil {
+			reporters.ReportError(eo.errorReporter, err)
+			reporters.ReportCount(eo.metricsReporter, "registry.identity.rejected", 1)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// PollFunc returns a kvresolver poll function that reads the entries for a
+// target service from the store, ignoring those with a heartbeat older than
+// ttl. The ttl should be several heartbeat intervals, to allow for missed
+// heartbeats and clock skew. The options are as for Entries.
+func PollFunc(store kv.Store, prefix string, ttl time.Duration, opts ...Option) kvresolver.ContextPollFunc {
+	return func(ctx context.Context, target string) ([]kvresolver.Endpoint, error) {
+		entries, err := Entries(ctx, store, prefix, target, ttl, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return Endpoints(entries), nil
+	}
+}
+
+// Endpoints returns the endpoints of entries.
+func Endpoints(entries []Entry) []kvresolver.Endpoint {
+	eps := make([]kvresolver.Endpoint, 0, len(entries))
+	for _, e := range entries {
+		eps = append(eps, e.Endpoint)
+	}
+	return eps
+}
@@ -0,0 +1,147 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lstoll/grpce/kv"
+	"github.com/lstoll/grpce/kvresolver"
+	"github.com/lstoll/grpce/reporters/reporterstest"
+)
+
+func TestRegistration(t *testing.T) {
+	ctx := context.Background()
+	store := kv.NewMemory()
+
+	r1, err := Register(ctx, store, "hello", Entry{
+		Endpoint:   kvresolver.Endpoint{Addr: "10.0.0.1:80", AvailabilityZone: "us-east-1a"},
+		InstanceID: "i-1",
+	}, WithHeartbeatInterval(5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r1.Stop()
+	r2, err := Register(ctx, store, "hello", Entry{
+		Endpoint: kvresolver.Endpoint{Addr: "10.0.0.2:80"},
+	}, WithHeartbeatInterval(5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r2.Key() != "services/hello/10.0.0.2:80" {
+		t.Errorf("want address used for missing instance ID, got key %q", r2.Key())
+	}
+
+	// A server that died without deregistering.
+	stale, _ := json.Marshal(&Entry{
+		Endpoint:   kvresolver.Endpoint{Addr: "10.0.0.3:80"},
+		InstanceID: "i-3",
+		Heartbeat:  time.Now().Add(-time.Hour),
+	})
+	if _, err := store.Put(ctx, Key(DefaultPrefix, "hello", "i-3"), stale, kv.Precondition{}); err != nil {
+		t.Fatal(err)
+	}
+	// Junk in the prefix doesn't break discovery.
+	if _, err := store.Put(ctx, Key(DefaultPrefix, "hello", "junk"), []byte("junk"), kv.Precondition{}); err != nil {
+		t.Fatal(err)
+	}
+
+	ec := &reporterstest.ErrorCollector{}
+	poll := PollFunc(store, DefaultPrefix, 50*time.Millisecond, WithErrorReporter(ec))
+	eps, err := poll(ctx, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(eps) != 2 || eps[0].Addr != "10.0.0.2:80" || eps[1].Addr != "10.0.0.1:80" || eps[1].AvailabilityZone != "us-east-1a" {
+		t.Errorf("Unexpected endpoints %+v", eps)
+	}
+	if len(ec.Errors()) != 1 || !strings.Contains(ec.Errors()[0].Error(), "malformed entry services/hello/junk") {
+		t.Errorf("want the junk entry reported, got %v", ec.Errors())
+	}
+
+	// Heartbeats keep the entry alive past the TTL.
+	time.Sleep(70 * time.Millisecond)
+	eps, err = poll(ctx, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(eps) != 2 {
+		t.Errorf("want heartbeating entries kept, got %+v", eps)
+	}
+
+	if err := r2.Deregister(ctx); err != nil {
+		t.Fatal(err)
+	}
+	eps, err = poll(ctx, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(eps) != 1 || eps[0].Addr != "10.0.0.1:80" {
+		t.Errorf("want deregistered entry removed, got %+v", eps)
+	}
+
+	// Without heartbeats the entry expires.
+	r1.Stop()
+	time.Sleep(70 * time.Millisecond)
+	eps, err = poll(ctx, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(eps) != 0 {
+		t.Errorf("want expired entry ignored, got %+v", eps)
+	}
+}
+
+func TestRegistrationUpdate(t *testing.T) {
+	ctx := context.Background()
+	store := kv.NewMemory()
+	r, err := Register(ctx, store, "hello", Entry{
+		Endpoint: kvresolver.Endpoint{Addr: "10.0.0.1:80"},
+	}, WithHeartbeatInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	if err := r.Update(ctx, func(e *Entry) {
+		e.Version = "v2"
+		e.Addr = "10.0.0.9:80"
+	}); err != nil {
+		t.Fatal(err)
+	}
+	o, err := store.Get(ctx, r.Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e Entry
+	if err := json.Unmarshal(o.Value, &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Version != "v2" {
+		t.Errorf("want update written immediately, got version %q", e.Version)
+	}
+	if e.Addr != "10.0.0.1:80" {
+		t.Errorf("want address unchanged, got %q", e.Addr)
+	}
+}
+
+func TestRegisterInvalidHeartbeat(t *testing.T) {
+	ctx := context.Background()
+	store := kv.NewMemory()
+	for _, d := range []time.Duration{0, -time.Second} {
+		if _, err := Register(ctx, store, "hello", Entry{
+			Endpoint: kvresolver.Endpoint{Addr: "10.0.0.1:80"},
+		}, WithHeartbeatInterval(d)); err == nil {
+			t.Errorf("want heartbeat interval %s rejected", d)
+		}
+	}
+	infos, err := store.List(ctx, DefaultPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 0 {
+		t.Errorf("want nothing written for a rejected registration, got %v", infos)
+	}
+}
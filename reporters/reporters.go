@@ -1,5 +1,7 @@
 package reporters
 
+import "time"
+
 type ErrorReporter interface {
 	ReportError(err error)
 }
@@ -9,6 +11,12 @@ type MetricsReporter interface {
 	Gauge(key string, val int64)
 }
 
+// TimingReporter can optionally be implemented by a MetricsReporter to record
+// durations natively.
+type TimingReporter interface {
+	Timing(key string, d time.Duration)
+}
+
 func ReportError(r ErrorReporter, err error) {
 	if r != nil {
 		r.ReportError(err)
@@ -26,3 +34,16 @@ func ReportGauge(r MetricsReporter, key string, val int64) {
 		r.Gauge(key, val)
 	}
 }
+
+// ReportTiming records a duration. If r implements TimingReporter it is used,
+// otherwise the duration is reported as a gauge in milliseconds.
+func ReportTiming(r MetricsReporter, key string, d time.Duration) {
+	if r == nil {
+		return
+	}
+	if tr, ok := r.(TimingReporter); ok {
+		tr.Timing(key, d)
+		return
+	}
+	r.Gauge(key, int64(d/time.Millisecond))
+}
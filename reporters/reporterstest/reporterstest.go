@@ -0,0 +1,26 @@
+// Package reporterstest provides reporters that record what is reported to
+// them, for tests to check.
+package reporterstest
+
+import "sync"
+
+// ErrorCollector is a reporters.ErrorReporter that keeps every error reported
+// to it. It is safe for concurrent use.
+type ErrorCollector struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+// ReportError records err.
+func (e *ErrorCollector) ReportError(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.errs = append(e.errs, err)
+}
+
+// Errors returns the errors reported so far, oldest first.
+func (e *ErrorCollector) Errors() []error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]error{}, e.errs...)
+}
@@ -0,0 +1,382 @@
+package selfcert
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lstoll/grpce/kv"
+	"github.com/lstoll/grpce/kvresolver"
+	"github.com/lstoll/grpce/registry"
+	"github.com/lstoll/grpce/reporters"
+	"google.golang.org/grpc/credentials"
+)
+
+// DefaultEntryTTL is how old a registry entry's heartbeat can be before it's
+// certificates are no longer trusted, if no TTL is given.
+const DefaultEntryTTL = 3 * registry.DefaultHeartbeatInterval
+
+// DefaultMinRefresh is the minimum time between reads of the registry
+// triggered by handshakes, if none is given.
+const DefaultMinRefresh = time.Second
+
+// PinError is reported and returned when a server's certificate is rejected.
+type PinError struct {
+	// Addr is the address that was dialled.
+	Addr string
+	// Reason is why the certificate was rejected.
+	Reason string
+}
+
+func (p *PinError) Error() string {
+	return fmt.Sprintf("selfcert: rejected certificate for %s: %s", p.Addr, p.Reason)
+}
+
+// Temporary returns false, so grpc.FailOnNonTempDialError fails the dial.
+func (p *PinError) Temporary() bool {
+	return false
+}
+
+type clientOptions struct {
+	prefix        string
+	ttl           time.Duration
+	minRefresh    time.Duration
+	errorReporter reporters.ErrorReporter
+	revocations   *Revocations
+	entryOptions  []registry.Option
+}
+
+// ClientOption configures ClientCredentials.
+type ClientOption func(*clientOptions)
+
+// WithRegistryPrefix sets the prefix registry entries are read from.
+func WithRegistryPrefix(prefix string) ClientOption {
+	return func(o *clientOptions) {
+		o.prefix = prefix
+	}
+}
+
+// WithEntryTTL sets how old an entry's heartbeat can be before it's
+// certificates are no longer trusted. It should match the TTL used for
+// discovery.
+func WithEntryTTL(ttl time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.ttl = ttl
+	}
+}
+
+// WithMinRefresh sets the minimum time between reads of the registry when a
+// handshake finds a server it has no pin for. This stops a misbehaving server
+// causing a read per connection attempt.
+func WithMinRefresh(d time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.minRefresh = d
+	}
+}
+
+// WithErrorReporter reports rejected certificates and failed registry reads.
+func WithErrorReporter(er reporters.ErrorReporter) ClientOption {
+	return func(o *clientOptions) {
+		o.errorReporter = er
+	}
+}
+
+// WithEntryOptions passes options through to registry.Entries when reading
+// entries. Use it with registry.WithIdentityVerification so only certificates
+// from verified entries are pinned.
+func WithEntryOptions(opts ...registry.Option) ClientOption {
+	return func(o *clientOptions) {
+		o.entryOptions = append(o.entryOptions, opts...)
+	}
+}
+
+// WithRevocations rejects handshakes with revoked servers, closes existing
+// connections to them when they are revoked, and filters them out of the
+// results of PollFunc.
+func WithRevocations(r *Revocations) ClientOption {
+	return func(o *clientOptions) {
+		o.revocations = r
+	}
+}
+
+// pinCache holds the fingerprints of the certificates published for each
+// address of a service.
+type pinCache struct {
+	store   kv.Store
+	service string
+	opts    *clientOptions
+
+	// refreshMu serialises reads of the registry.
+	refreshMu sync.Mutex
+
+	mu        sync.Mutex
+	pins      map[string]map[string]bool
+	instances map[string]string
+	refreshed time.Time
+	// conns are the open connections, so they can be closed if revoked.
+	conns map[*pinnedConn]struct{}
+	// unsubscribe stops revocation notifications.
+	unsubscribe func()
+}
+
+// ClientCredentials are grpc transport credentials that only accept the
+// certificates a server published in it's registry entry. The server is
+// identified by the address that was dialled, not by name, so entries must
+// advertise the address clients connect to.
+//
+// Pins are cached, and refreshed whenever the poll function returned by
+// PollFunc runs. A handshake with a server that has no pin, or presents a
+// certificate that isn't pinned, triggers an immediate refresh.
+type ClientCredentials struct {
+	pins *pinCache
+}
+
+// NewClientCredentials returns credentials for dialling service, pinning the
+// certificates published in it's registry entries.
+func NewClientCredentials(store kv.Store, service string, opts ...ClientOption) *ClientCredentials {
+	o := &clientOptions{
+		prefix:     registry.DefaultPrefix,
+		ttl:        DefaultEntryTTL,
+		minRefresh: DefaultMinRefresh,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	p := &pinCache{
+		store:     store,
+		service:   service,
+		opts:      o,
+		pins:      map[string]map[string]bool{},
+		instances: map[string]string{},
+		conns:     map[*pinnedConn]struct{}{},
+	}
+	if o.revocations != nil {
+		p.unsubscribe = o.revocations.subscribe(p.closeRevoked)
+	}
+	return &ClientCredentials{pins: p}
+}
+
+// Close stops the credentials closing connections when their server is
+// revoked, releasing them from the revocation list. Revoked servers are still
+// refused on new handshakes. Clones share this, so closing one closes all.
+func (c *ClientCredentials) Close() {
+	if c.pins.unsubscribe != nil {
+		c.pins.unsubscribe()
+	}
+}
+
+// PollFunc returns a kvresolver poll function for the service's registry
+// entries, that also refreshes the pins. Using it for discovery keeps the
+// pins in step with the addresses the balancer connects to.
+func (c *ClientCredentials) PollFunc() kvresolver.ContextPollFunc {
+	return func(ctx context.Context, target string) ([]kvresolver.Endpoint, error) {
+		entries, err := registry.Entries(ctx, c.pins.store, c.pins.opts.prefix, target, c.pins.opts.ttl, c.pins.opts.entryOptions...)
+		if err != nil {
+			return nil, err
+		}
+		if target == c.pins.service {
+			c.pins.set(entries)
+		}
+		if revs := c.pins.opts.revocations; revs != nil {
+			live := entries[:0]
+			for _, e := range entries {
+				if revs.entryRevoked(e) == nil {
+					live = append(live, e)
+				}
+			}
+			entries = live
+		}
+		return registry.Endpoints(entries), nil
+	}
+}
+
+// set replaces the pins with those published in entries.
+func (p *pinCache) set(entries []registry.Entry) {
+	pins := map[string]map[string]bool{}
+	instances := map[string]string{}
+	for _, e := range entries {
+		instances[e.Addr] = e.InstanceID
+		for _, s := range e.Certificates {
+			cert, err := ParsePEM(s)
+			if err != nil {
+				reporters.ReportError(p.opts.errorReporter, err)
+				continue
+			}
+			if pins[e.Addr] == nil {
+				pins[e.Addr] = map[string]bool{}
+			}
+			pins[e.Addr][Fingerprint(cert)] = true
+		}
+	}
+	p.mu.Lock()
+	p.pins = pins
+	p.instances = instances
+	p.refreshed = time.Now()
+	p.mu.Unlock()
+}
+
+// pinned returns true if fingerprint is pinned for addr, and whether any
+// certificates are pinned for addr at all.
+func (p *pinCache) pinned(addr, fingerprint string) (match, known bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fps := p.pins[addr]
+	return fps[fingerprint], len(fps) > 0
+}
+
+// refresh re-reads the registry, unless it was read within the minimum
+// refresh interval.
+func (p *pinCache) refresh(ctx context.Context) {
+	p.refreshMu.Lock()
+	defer p.refreshMu.Unlock()
+	p.mu.Lock()
+	recent := time.Since(p.refreshed) < p.opts.minRefresh
+	p.mu.Unlock()
+	if recent {
+		return
+	}
+	entries, err := registry.Entries(ctx, p.store, p.opts.prefix, p.service, p.opts.ttl, p.opts.entryOptions...)
+	if err != nil {
+		reporters.ReportError(p.opts.errorReporter, err)
+		return
+	}
+	p.set(entries)
+}
+
+// verify checks the certificate presented by addr against it's pins,
+// returning the certificate's fingerprint if it's accepted.
+func (p *pinCache) verify(ctx context.Context, addr string, raw [][]byte) (string, error) {
+	if len(raw) == 0 {
+		return "", p.reject(addr, "no certificate presented")
+	}
+	cert, err := x509.ParseCertificate(raw[0])
+	if err != nil {
+		return "", p.reject(addr, err.Error())
+	}
+	if now := time.Now(); now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return "", p.reject(addr, "certificate is not valid at the current time")
+	}
+
+	fp := Fingerprint(cert)
+	match, _ := p.pinned(addr, fp)
+	if !match {
+		p.refresh(ctx)
+		var known bool
+		match, known = p.pinned(addr, fp)
+		if !known {
+			return "", p.reject(addr, "no certificate published for address")
+		}
+	}
+	if !match {
+		return "", p.reject(addr, "certificate "+fp+" is not published for address")
+	}
+	if rev := p.revoked(addr, fp); rev != nil {
+		return "", p.reject(addr, "revoked: "+rev.Reason)
+	}
+	return fp, nil
+}
+
+// revoked returns the revocation covering the key fingerprint, or the
+// instance published at addr.
+func (p *pinCache) revoked(addr, fingerprint string) *Revocation {
+	p.mu.Lock()
+	instance := p.instances[addr]
+	p.mu.Unlock()
+	return p.opts.revocations.Revoked(fingerprint, instance)
+}
+
+// closeRevoked closes open connections to servers that have been revoked.
+func (p *pinCache) closeRevoked() {
+	p.mu.Lock()
+	var revoked []*pinnedConn
+	for c := range p.conns {
+		revoked = append(revoked, c)
+	}
+	p.mu.Unlock()
+	for _, c := range revoked {
+		if rev := p.revoked(c.addr, c.fingerprint); rev != nil {
+			p.reject(c.addr, "revoked: "+rev.Reason)
+			c.Close()
+		}
+	}
+}
+
+// pinnedConn is a connection that passed the pin check. It's tracked while
+// open, so it can be closed if the server is revoked.
+type pinnedConn struct {
+	net.Conn
+	addr        string
+	fingerprint string
+	pins        *pinCache
+}
+
+func (c *pinnedConn) Close() error {
+	c.pins.mu.Lock()
+	delete(c.pins.conns, c)
+	c.pins.mu.Unlock()
+	return c.Conn.Close()
+}
+
+func (p *pinCache) reject(addr, reason string) error {
+	err := &PinError{Addr: addr, Reason: reason}
+	reporters.ReportError(p.opts.errorReporter, err)
+	return err
+}
+
+// ClientHandshake does the TLS handshake with the server, and rejects it
+// unless the server presents a pinned certificate for the address dialled.
+func (c *ClientCredentials) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	addr := rawConn.RemoteAddr().String()
+	var fingerprint string
+	cfg := &tls.Config{
+		// The certificates are self-signed, the pin check replaces chain
+		// verification.
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS12,
+		VerifyPeerCertificate: func(raw [][]byte, _ [][]*x509.Certificate) error {
+			var err error
+			fingerprint, err = c.pins.verify(ctx, addr, raw)
+			return err
+		},
+	}
+	conn, info, err := credentials.NewTLS(cfg).ClientHandshake(ctx, authority, rawConn)
+	if err != nil {
+		return nil, nil, err
+	}
+	pc := &pinnedConn{Conn: conn, addr: addr, fingerprint: fingerprint, pins: c.pins}
+	c.pins.mu.Lock()
+	c.pins.conns[pc] = struct{}{}
+	c.pins.mu.Unlock()
+	// Revoked while we were handshaking.
+	if rev := c.pins.revoked(addr, fingerprint); rev != nil {
+		pc.Close()
+		return nil, nil, c.pins.reject(addr, "revoked: "+rev.Reason)
+	}
+	return pc, info, nil
+}
+
+// ServerHandshake always fails, these credentials are only for clients.
+func (c *ClientCredentials) ServerHandshake(rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("selfcert: client credentials can't be used by a server")
+}
+
+// Info returns the protocol info, as reported by grpc's TLS credentials. The
+// version actually negotiated is in the credentials.TLSInfo of each handshake.
+func (c *ClientCredentials) Info() credentials.ProtocolInfo {
+	return credentials.NewTLS(&tls.Config{}).Info()
+}
+
+// Clone returns a copy of the credentials, sharing the pin cache.
+func (c *ClientCredentials) Clone() credentials.TransportCredentials {
+	return &ClientCredentials{pins: c.pins}
+}
+
+// OverrideServerName is a no-op, servers are identified by address not name.
+func (c *ClientCredentials) OverrideServerName(string) error {
+	return nil
+}
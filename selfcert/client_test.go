@@ -0,0 +1,138 @@
+package selfcert
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/resolver"
+
+	"github.com/lstoll/grpce/helloproto"
+	"github.com/lstoll/grpce/kv"
+	"github.com/lstoll/grpce/kvresolver"
+	"github.com/lstoll/grpce/registry"
+	"github.com/lstoll/grpce/reporters/reporterstest"
+)
+
+// pinErrors returns the pin errors reported to ec.
+func pinErrors(ec *reporterstest.ErrorCollector) []*PinError {
+	var ret []*PinError
+	for _, err := range ec.Errors() {
+		if pe, ok := err.(*PinError); ok {
+			ret = append(ret, pe)
+		}
+	}
+	return ret
+}
+
+func dial(addr string, creds *ClientCredentials) (*grpc.ClientConn, error) {
+	return grpc.Dial(addr,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithBlock(),
+		grpc.FailOnNonTempDialError(true),
+		grpc.WithTimeout(time.Second),
+	)
+}
+
+func TestClientCredentialsWithResolver(t *testing.T) {
+	store := kv.NewMemory()
+	for i := 0; i < 2; i++ {
+		_, _, stop := startServer(t, store)
+		defer stop()
+	}
+
+	ec := &reporterstest.ErrorCollector{}
+	creds := NewClientCredentials(store, "hello", WithErrorReporter(ec))
+	b := kvresolver.NewContextBuilder(time.Hour, creds.PollFunc(),
+		kvresolver.WithScheme("selfcerttest"),
+		kvresolver.WithServiceConfig(`{"loadBalancingPolicy":"round_robin"}`),
+	)
+	resolver.Register(b)
+	defer resolver.UnregisterForTesting(b.Scheme())
+
+	conn, err := grpc.Dial("selfcerttest:///hello",
+		grpc.WithTransportCredentials(creds),
+		grpc.WithBlock(),
+		grpc.WithTimeout(time.Second),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := helloproto.NewHelloClient(conn)
+	for i := 0; i < 4; i++ {
+		var p peer.Peer
+		if _, err := c.HelloWorld(context.Background(), &helloproto.HelloRequest{}, grpc.Peer(&p)); err != nil {
+			t.Fatal(err)
+		}
+		// The negotiated version is reported per connection.
+		if ti, ok := p.AuthInfo.(credentials.TLSInfo); !ok || ti.State.Version < tls.VersionTLS12 {
+			t.Errorf("want TLS 1.2 or later reported for the connection, got %#v", p.AuthInfo)
+		}
+	}
+	if errs := pinErrors(ec); len(errs) != 0 {
+		t.Errorf("want no pin errors, got %v", errs)
+	}
+	if info := creds.Info(); info != credentials.NewTLS(&tls.Config{}).Info() {
+		t.Errorf("want the same protocol info as grpc's TLS credentials, got %+v", info)
+	}
+}
+
+func TestClientCredentialsRejectsUnpublished(t *testing.T) {
+	store := kv.NewMemory()
+	srv, addr, stop := startServer(t, store)
+	defer stop()
+
+	// Someone else's cert is published for the address.
+	other, err := Generate(nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Registration().Update(context.Background(), func(e *registry.Entry) {
+		e.Certificates = []string{EncodePEM(other.Leaf)}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ec := &reporterstest.ErrorCollector{}
+	if _, err := dial(addr, NewClientCredentials(store, "hello", WithErrorReporter(ec))); err == nil {
+		t.Fatal("want dial to fail with an unpublished certificate")
+	}
+	errs := pinErrors(ec)
+	if len(errs) == 0 || errs[0].Addr != addr {
+		t.Fatalf("want pin error for %s reported, got %v", addr, errs)
+	}
+
+	// And with nothing published at all.
+	if err := srv.Registration().Deregister(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ec = &reporterstest.ErrorCollector{}
+	if _, err := dial(addr, NewClientCredentials(store, "hello", WithErrorReporter(ec))); err == nil {
+		t.Fatal("want dial to fail with no published certificate")
+	}
+	if errs := pinErrors(ec); len(errs) == 0 || errs[0].Reason != "no certificate published for address" {
+		t.Errorf("Unexpected pin errors %v", errs)
+	}
+}
+
+func TestClientCredentialsRefreshesOnMiss(t *testing.T) {
+	store := kv.NewMemory()
+	creds := NewClientCredentials(store, "hello", WithMinRefresh(0))
+	// Populate the cache before the server exists.
+	if _, err := creds.PollFunc()(context.Background(), "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, addr, stop := startServer(t, store)
+	defer stop()
+	conn, err := dial(addr, creds)
+	if err != nil {
+		t.Fatalf("want handshake to refresh pins, got %v", err)
+	}
+	conn.Close()
+}
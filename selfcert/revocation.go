@@ -0,0 +1,245 @@
+package selfcert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lstoll/grpce/kv"
+	"github.com/lstoll/grpce/registry"
+	"github.com/lstoll/grpce/reporters"
+)
+
+// DefaultRevocationKey is the key the revocation list is conventionally stored
+// under.
+const DefaultRevocationKey = "revocations.json"
+
+// Revocation revokes a server's credentials, either a single key by it's
+// fingerprint, or everything published by an instance.
+type Revocation struct {
+	// Fingerprint is the Fingerprint of a revoked certificate's key.
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// InstanceID revokes all certificates published by the instance.
+	InstanceID string `json:"instanceId,omitempty"`
+	// Reason is a human readable reason for the revocation.
+	Reason string `json:"reason"`
+	// Revoked is when the revocation was made.
+	Revoked time.Time `json:"revoked"`
+}
+
+// RevocationList is the stored form of the revocation list.
+type RevocationList struct {
+	Revocations []Revocation `json:"revocations"`
+}
+
+// Revoke adds rev to the revocation list stored at key. The write is
+// conditional on the list not having changed since it was read, on a
+// conflict kv.ErrPreconditionFailed is returned and the caller should retry.
+func Revoke(ctx context.Context, store kv.Store, key string, rev Revocation) error {
+	var (
+		l   RevocationList
+		pre kv.Precondition
+	)
+	o, err := store.Get(ctx, key)
+	switch err {
+	case nil:
+		if err := json.Unmarshal(o.Value, &l); err != nil {
+			return err
+		}
+		pre.IfMatch = o.ETag
+	case kv.ErrNotFound:
+		pre.IfNoneMatch = "*"
+	default:
+		return err
+	}
+
+	if rev.Revoked.IsZero() {
+		rev.Revoked = time.Now().UTC()
+	}
+	l.Revocations = append(l.Revocations, rev)
+	b, err := json.Marshal(&l)
+	if err != nil {
+		return err
+	}
+	_, err = store.Put(ctx, key, b, pre)
+	return err
+}
+
+// Revocations keeps a local copy of the revocation list, polling the store
+// for changes.
+type Revocations struct {
+	store kv.Store
+	key   string
+	opts  *clientOptions
+
+	mu            sync.Mutex
+	etag          string
+	byFingerprint map[string]*Revocation
+	byInstance    map[string]*Revocation
+	subs          map[int]func()
+	nextSub       int
+
+	cancel context.CancelFunc
+	exited chan struct{}
+	once   sync.Once
+}
+
+// WatchRevocations loads the revocation list stored at key, and polls it
+// every interval until closed. The interval must be positive. A missing list
+// revokes nothing, but any other error loading it is returned, rather than
+// starting without it. Of the options only WithErrorReporter applies, for
+// failed polls.
+func WatchRevocations(ctx context.Context, store kv.Store, key string, interval time.Duration, opts ...ClientOption) (*Revocations, error) {
+	if interval <= 0 {
+		return nil, errors.New("selfcert: revocation poll interval must be positive")
+	}
+	o := &clientOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	r := &Revocations{
+		store:  store,
+		key:    key,
+		opts:   o,
+		exited: make(chan struct{}),
+	}
+	if err := r.poll(ctx); err != nil {
+		return nil, err
+	}
+
+	pollCtx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	go r.run(pollCtx, interval)
+	return r, nil
+}
+
+func (r *Revocations) run(ctx context.Context, interval time.Duration) {
+	defer close(r.exited)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.poll(ctx); err != nil && ctx.Err() == nil {
+				reporters.ReportError(r.opts.errorReporter, err)
+			}
+		}
+	}
+}
+
+// poll reads the list, and notifies subscribers if it has changed.
+func (r *Revocations) poll(ctx context.Context) error {
+	var (
+		l    RevocationList
+		etag string
+	)
+	o, err := r.store.Get(ctx, r.key)
+	switch err {
+	case nil:
+		if err := json.Unmarshal(o.Value, &l); err != nil {
+			return err
+		}
+		etag = o.ETag
+	case kv.ErrNotFound:
+	default:
+		return err
+	}
+
+	byFingerprint := map[string]*Revocation{}
+	byInstance := map[string]*Revocation{}
+	for i := range l.Revocations {
+		rev := &l.Revocations[i]
+		if rev.Fingerprint != "" {
+			byFingerprint[rev.Fingerprint] = rev
+		}
+		if rev.InstanceID != "" {
+			byInstance[rev.InstanceID] = rev
+		}
+	}
+
+	r.mu.Lock()
+	changed := etag != r.etag
+	r.etag = etag
+	r.byFingerprint = byFingerprint
+	r.byInstance = byInstance
+	var subs []func()
+	if changed {
+		for _, fn := range r.subs {
+			subs = append(subs, fn)
+		}
+	}
+	r.mu.Unlock()
+	for _, fn := range subs {
+		fn()
+	}
+	return nil
+}
+
+// Revoked returns the revocation covering a key fingerprint or instance ID,
+// or nil if neither is revoked. Either can be empty.
+func (r *Revocations) Revoked(fingerprint, instanceID string) *Revocation {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if rev := r.byFingerprint[fingerprint]; fingerprint != "" && rev != nil {
+		return rev
+	}
+	if rev := r.byInstance[instanceID]; instanceID != "" && rev != nil {
+		return rev
+	}
+	return nil
+}
+
+// entryRevoked returns the revocation covering an entry's instance, or if
+// every one of it's certificates is revoked the revocation for one of them.
+// An entry with some unrevoked certificates is still usable, e.g while it's
+// rotating away from a revoked key.
+func (r *Revocations) entryRevoked(e registry.Entry) *Revocation {
+	if rev := r.Revoked("", e.InstanceID); rev != nil {
+		return rev
+	}
+	var rev *Revocation
+	for _, s := range e.Certificates {
+		cert, err := ParsePEM(s)
+		if err != nil {
+			continue
+		}
+		rev = r.Revoked(Fingerprint(cert), "")
+		if rev == nil {
+			return nil
+		}
+	}
+	return rev
+}
+
+// subscribe calls fn whenever the list changes, until the returned func is
+// called.
+func (r *Revocations) subscribe(fn func()) (unsubscribe func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.subs == nil {
+		r.subs = map[int]func(){}
+	}
+	id := r.nextSub
+	r.nextSub++
+	r.subs[id] = fn
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.subs, id)
+	}
+}
+
+// Close stops polling. It is safe to call multiple times.
+func (r *Revocations) Close() {
+	r.once.Do(func() {
+		r.cancel()
+		<-r.exited
+	})
+}
@@ -0,0 +1,170 @@
+package selfcert
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/lstoll/grpce/helloproto"
+	"github.com/lstoll/grpce/kv"
+	"github.com/lstoll/grpce/registry"
+	"github.com/lstoll/grpce/reporters/reporterstest"
+)
+
+func TestRevocations(t *testing.T) {
+	ctx := context.Background()
+	store := kv.NewMemory()
+
+	revs, err := WatchRevocations(ctx, store, DefaultRevocationKey, time.Hour)
+	if err != nil {
+		t.Fatalf("want a missing list to revoke nothing, got %v", err)
+	}
+	revs.Close()
+
+	if err := Revoke(ctx, store, DefaultRevocationKey, Revocation{Fingerprint: "abc", Reason: "key leaked"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Revoke(ctx, store, DefaultRevocationKey, Revocation{InstanceID: "i-1", Reason: "compromised"}); err != nil {
+		t.Fatal(err)
+	}
+
+	revs, err = WatchRevocations(ctx, store, DefaultRevocationKey, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer revs.Close()
+	if rev := revs.Revoked("abc", ""); rev == nil || rev.Reason != "key leaked" || rev.Revoked.IsZero() {
+		t.Errorf("Unexpected fingerprint revocation %+v", rev)
+	}
+	if rev := revs.Revoked("", "i-1"); rev == nil || rev.Reason != "compromised" {
+		t.Errorf("Unexpected instance revocation %+v", rev)
+	}
+	if rev := revs.Revoked("def", "i-2"); rev != nil {
+		t.Errorf("want nothing revoked, got %+v", rev)
+	}
+
+	if _, err := store.Put(ctx, "junk.json", []byte("junk"), kv.Precondition{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WatchRevocations(ctx, store, "junk.json", time.Hour); err == nil {
+		t.Error("want error loading a corrupt list")
+	}
+	for _, d := range []time.Duration{0, -time.Second} {
+		if _, err := WatchRevocations(ctx, store, DefaultRevocationKey, d); err == nil {
+			t.Errorf("want poll interval %s rejected", d)
+		}
+	}
+}
+
+func TestRevocationClosesConnections(t *testing.T) {
+	ctx := context.Background()
+	store := kv.NewMemory()
+	srv, addr, stop := startServer(t, store)
+	defer stop()
+
+	revs, err := WatchRevocations(ctx, store, DefaultRevocationKey, 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer revs.Close()
+	ec := &reporterstest.ErrorCollector{}
+	creds := NewClientCredentials(store, "hello", WithRevocations(revs), WithErrorReporter(ec))
+
+	conn, err := dial(addr, creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := helloproto.NewHelloClient(conn)
+	if _, err := c.HelloWorld(ctx, &helloproto.HelloRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Revoke(ctx, store, DefaultRevocationKey, Revocation{Fingerprint: Fingerprint(srv.Certificate().Leaf), Reason: "test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		_, err := c.HelloWorld(rctx, &helloproto.HelloRequest{}, grpc.WaitForReady(false))
+		cancel()
+		if err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Connection to revoked server still usable")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	var revoked bool
+	for _, pe := range pinErrors(ec) {
+		if pe.Addr == addr && strings.HasPrefix(pe.Reason, "revoked") {
+			revoked = true
+		}
+	}
+	if !revoked {
+		t.Errorf("want revocation reported, got %v", pinErrors(ec))
+	}
+
+	// New connections are refused too.
+	if _, err := dial(addr, creds); err == nil {
+		t.Error("want dial to a revoked server to fail")
+	}
+
+	// And it's filtered from discovery.
+	eps, err := creds.PollFunc()(ctx, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(eps) != 0 {
+		t.Errorf("want revoked server filtered, got %v", eps)
+	}
+}
+
+func TestClientCredentialsClose(t *testing.T) {
+	revs, err := WatchRevocations(context.Background(), kv.NewMemory(), DefaultRevocationKey, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer revs.Close()
+
+	a := NewClientCredentials(kv.NewMemory(), "hello", WithRevocations(revs))
+	b := NewClientCredentials(kv.NewMemory(), "hello", WithRevocations(revs))
+	a.Close()
+	a.Clone().(*ClientCredentials).Close()
+	revs.mu.Lock()
+	n := len(revs.subs)
+	revs.mu.Unlock()
+	if n != 1 {
+		t.Errorf("want only the open credentials subscribed, got %d subscribers", n)
+	}
+	b.Close()
+}
+
+func TestEntryRevoked(t *testing.T) {
+	ctx := context.Background()
+	store := kv.NewMemory()
+	oldCert, _ := Generate(nil, time.Hour)
+	newCert, _ := Generate(nil, time.Hour)
+	if err := Revoke(ctx, store, DefaultRevocationKey, Revocation{Fingerprint: Fingerprint(oldCert.Leaf)}); err != nil {
+		t.Fatal(err)
+	}
+	revs, err := WatchRevocations(ctx, store, DefaultRevocationKey, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer revs.Close()
+
+	e := registry.Entry{InstanceID: "i-1", Certificates: []string{EncodePEM(oldCert.Leaf)}}
+	if revs.entryRevoked(e) == nil {
+		t.Error("want entry with only a revoked certificate revoked")
+	}
+	e.Certificates = append(e.Certificates, EncodePEM(newCert.Leaf))
+	if revs.entryRevoked(e) != nil {
+		t.Error("want entry with an unrevoked certificate usable")
+	}
+}
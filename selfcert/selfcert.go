@@ -0,0 +1,102 @@
+// Package selfcert gives each server it's own TLS identity, without a CA.
+//
+// At startup a server generates a key and a self-signed certificate. The key
+// never leaves memory, and the certificate is published in the server's
+// registry entry. Clients pin the certificates published for the address they
+// dial, so they know they are talking to the exact server that registered it,
+// and a single server's credentials can be revoked without affecting any
+// other.
+package selfcert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"time"
+)
+
+// DefaultValidity is how long generated certificates are valid for if no
+// validity is given.
+const DefaultValidity = 30 * 24 * time.Hour
+
+// clockSkew is allowed for at each end of a certificate's validity.
+const clockSkew = 5 * time.Minute
+
+// Generate creates a new key, and a certificate for it valid for hosts. Hosts
+// can be IP addresses or DNS names. The validity period is extended slightly
+// at both ends to allow for clock skew.
+func Generate(hosts []string, validity time.Duration) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "grpce self-signed"},
+		NotBefore:    now.Add(-clockSkew),
+		NotAfter:     now.Add(validity + clockSkew),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else if h != "" {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	if len(hosts) > 0 {
+		tmpl.Subject.CommonName = hosts[0]
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+// EncodePEM returns the PEM encoding of cert, as published in registry
+// entries.
+func EncodePEM(cert *x509.Certificate) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+}
+
+// ParsePEM parses a certificate published in a registry entry.
+func ParsePEM(s string) (*x509.Certificate, error) {
+	b, _ := pem.Decode([]byte(s))
+	if b == nil || b.Type != "CERTIFICATE" {
+		return nil, errors.New("selfcert: no PEM certificate found")
+	}
+	return x509.ParseCertificate(b.Bytes)
+}
+
+// Fingerprint returns the hex encoded SHA-256 of the certificate's
+// SubjectPublicKeyInfo. This identifies the key, rather than the certificate.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return hex.EncodeToString(sum[:])
+}
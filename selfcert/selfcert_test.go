@@ -0,0 +1,124 @@
+package selfcert
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/lstoll/grpce/helloproto"
+	"github.com/lstoll/grpce/kv"
+	"github.com/lstoll/grpce/kvresolver"
+	"github.com/lstoll/grpce/registry"
+)
+
+func TestGenerate(t *testing.T) {
+	cert, err := Generate([]string{"10.0.0.1", "hello.internal"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.Leaf.VerifyHostname("10.0.0.1"); err != nil {
+		t.Error(err)
+	}
+	if err := cert.Leaf.VerifyHostname("hello.internal"); err != nil {
+		t.Error(err)
+	}
+
+	parsed, err := ParsePEM(EncodePEM(cert.Leaf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Fingerprint(parsed) != Fingerprint(cert.Leaf) {
+		t.Error("Fingerprint changed after a PEM round trip")
+	}
+	other, err := Generate(nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Fingerprint(other.Leaf) == Fingerprint(cert.Leaf) {
+		t.Error("Different keys have the same fingerprint")
+	}
+
+	if _, err := ParsePEM("junk"); err == nil {
+		t.Error("want error parsing junk")
+	}
+}
+
+// startServer starts a hello server on a local port, registered with a
+// self-signed certificate.
+func startServer(t *testing.T, store kv.Store, opts ...ServerOption) (*Server, string, func()) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := NewServer(context.Background(), store, "hello", registry.Entry{
+		Endpoint: kvresolver.Endpoint{Addr: lis.Addr().String()},
+	}, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer(grpc.Creds(srv.Credentials()))
+	helloproto.RegisterHelloServer(s, &helloproto.TestHelloServer{ServerName: "1"})
+	go s.Serve(lis)
+	return srv, lis.Addr().String(), func() {
+		s.Stop()
+		srv.Stop()
+	}
+}
+
+func TestServerPublishesCertificate(t *testing.T) {
+	store := kv.NewMemory()
+	srv, addr, stop := startServer(t, store)
+	defer stop()
+
+	o, err := store.Get(context.Background(), srv.Registration().Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e registry.Entry
+	if err := json.Unmarshal(o.Value, &e); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Certificates) != 1 {
+		t.Fatalf("want 1 published certificate, got %d", len(e.Certificates))
+	}
+	published, err := ParsePEM(e.Certificates[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Pin the published cert by hand.
+	cfg := &tls.Config{
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(raw [][]byte, _ [][]*x509.Certificate) error {
+			c, err := x509.ParseCertificate(raw[0])
+			if err != nil {
+				return err
+			}
+			if Fingerprint(c) != Fingerprint(published) {
+				return errors.New("certificate does not match published one")
+			}
+			return nil
+		},
+	}
+	conn, err := grpc.Dial(addr,
+		grpc.WithTransportCredentials(credentials.NewTLS(cfg)),
+		grpc.WithBlock(),
+		grpc.WithTimeout(time.Second),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := helloproto.NewHelloClient(conn).HelloWorld(context.Background(), &helloproto.HelloRequest{}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,246 @@
+package selfcert
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lstoll/grpce/kv"
+	"github.com/lstoll/grpce/registry"
+	"github.com/lstoll/grpce/reporters"
+	"google.golang.org/grpc/credentials"
+)
+
+type serverOptions struct {
+	validity        time.Duration
+	hosts           []string
+	registryOptions []registry.Option
+	rotateEvery     time.Duration
+	rotateOverlap   time.Duration
+	errorReporter   reporters.ErrorReporter
+	metricsReporter reporters.MetricsReporter
+}
+
+// ServerOption configures a Server.
+type ServerOption func(*serverOptions)
+
+// WithValidity sets how long generated certificates are valid for.
+func WithValidity(d time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		o.validity = d
+	}
+}
+
+// WithHosts adds extra names or IPs the certificate is valid for, in addition
+// to the entry's address and server name.
+func WithHosts(hosts ...string) ServerOption {
+	return func(o *serverOptions) {
+		o.hosts = append(o.hosts, hosts...)
+	}
+}
+
+// WithRegistryOptions passes options through to registry.Register.
+func WithRegistryOptions(opts ...registry.Option) ServerOption {
+	return func(o *serverOptions) {
+		o.registryOptions = append(o.registryOptions, opts...)
+	}
+}
+
+// WithRotation replaces the server's key every interval. A new certificate is
+// published alongside the current one overlap before the server switches to
+// it, and the old certificate is withdrawn overlap after. Clients accept
+// either while both are published. The interval must be at least twice the
+// overlap, and the overlap should be long enough for clients to poll the
+// registry. Certificates are valid for interval plus twice the overlap, unless
+// WithValidity is also given.
+func WithRotation(interval, overlap time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		o.rotateEvery = interval
+		o.rotateOverlap = overlap
+	}
+}
+
+// WithServerErrorReporter reports failed rotations. A failed publish is
+// retried by the next registry heartbeat, so rotation carries on regardless.
+func WithServerErrorReporter(er reporters.ErrorReporter) ServerOption {
+	return func(o *serverOptions) {
+		o.errorReporter = er
+	}
+}
+
+// WithServerMetricsReporter counts rotations.
+func WithServerMetricsReporter(mr reporters.MetricsReporter) ServerOption {
+	return func(o *serverOptions) {
+		o.metricsReporter = mr
+	}
+}
+
+// Server is a registered server with a self-signed certificate.
+type Server struct {
+	reg  *registry.Registration
+	opts *serverOptions
+
+	certMu sync.RWMutex
+	cert   *tls.Certificate
+
+	cancel context.CancelFunc
+	exited chan struct{}
+	once   sync.Once
+}
+
+// NewServer generates a key and certificate, and registers entry for service
+// with the certificate published in it. Any certificates already in the entry
+// are replaced.
+func NewServer(ctx context.Context, store kv.Store, service string, entry registry.Entry, opts ...ServerOption) (*Server, error) {
+	o := &serverOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.rotateEvery > 0 && o.rotateEvery < 2*o.rotateOverlap {
+		return nil, errors.New("selfcert: rotation interval must be at least twice the overlap")
+	}
+	if o.validity == 0 {
+		o.validity = DefaultValidity
+		if o.rotateEvery > 0 {
+			o.validity = o.rotateEvery + 2*o.rotateOverlap
+		}
+	}
+
+	hosts := append([]string{}, o.hosts...)
+	if host, _, err := net.SplitHostPort(entry.Addr); err == nil {
+		hosts = append(hosts, host)
+	}
+	if entry.ServerName != "" {
+		hosts = append(hosts, entry.ServerName)
+	}
+	o.hosts = hosts
+
+	cert, err := Generate(o.hosts, o.validity)
+	if err != nil {
+		return nil, err
+	}
+	entry.Certificates = []string{EncodePEM(cert.Leaf)}
+
+	reg, err := registry.Register(ctx, store, service, entry, o.registryOptions...)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{reg: reg, opts: o, cert: cert, exited: make(chan struct{})}
+	rotCtx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	if o.rotateEvery > 0 {
+		go s.rotate(rotCtx)
+	} else {
+		close(s.exited)
+	}
+	return s, nil
+}
+
+// rotate replaces the key on schedule until the context is cancelled.
+func (s *Server) rotate(ctx context.Context) {
+	defer close(s.exited)
+	for {
+		if !sleep(ctx, s.opts.rotateEvery-2*s.opts.rotateOverlap) {
+			return
+		}
+		next, err := Generate(s.opts.hosts, s.opts.validity)
+		if err != nil {
+			reporters.ReportError(s.opts.errorReporter, err)
+			if !sleep(ctx, s.opts.rotateOverlap) {
+				return
+			}
+			continue
+		}
+		curr := s.Certificate()
+		s.publish(ctx, curr, next)
+		if !sleep(ctx, s.opts.rotateOverlap) {
+			return
+		}
+
+		s.certMu.Lock()
+		s.cert = next
+		s.certMu.Unlock()
+		reporters.ReportCount(s.opts.metricsReporter, "selfcert.rotations", 1)
+
+		if !sleep(ctx, s.opts.rotateOverlap) {
+			return
+		}
+		s.publish(ctx, next)
+	}
+}
+
+// publish replaces the certificates in the registry entry.
+func (s *Server) publish(ctx context.Context, certs ...*tls.Certificate) {
+	pems := make([]string, 0, len(certs))
+	for _, c := range certs {
+		pems = append(pems, EncodePEM(c.Leaf))
+	}
+	err := s.reg.Update(ctx, func(e *registry.Entry) {
+		e.Certificates = pems
+	})
+	if err != nil && ctx.Err() == nil {
+		reporters.ReportError(s.opts.errorReporter, err)
+	}
+}
+
+// sleep waits for d, returning false if the context is cancelled first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// Registration returns the server's registry entry.
+func (s *Server) Registration() *registry.Registration {
+	return s.reg
+}
+
+// Certificate returns the certificate currently presented to clients.
+func (s *Server) Certificate() *tls.Certificate {
+	s.certMu.RLock()
+	defer s.certMu.RUnlock()
+	return s.cert
+}
+
+func (s *Server) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return s.Certificate(), nil
+}
+
+// TLSConfig returns a server tls.Config presenting the server's certificate.
+func (s *Server) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: s.getCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+}
+
+// Credentials returns grpc server credentials presenting the server's
+// certificate.
+func (s *Server) Credentials() credentials.TransportCredentials {
+	return credentials.NewTLS(s.TLSConfig())
+}
+
+// Stop stops rotating the key and heartbeating the registry entry, leaving it
+// to expire. It is safe to call multiple times.
+func (s *Server) Stop() {
+	s.once.Do(func() {
+		s.cancel()
+		<-s.exited
+	})
+	s.reg.Stop()
+}
+
+// Deregister stops the server and removes the registry entry. It should be
+// called on graceful shutdown, before the server stops accepting connections.
+func (s *Server) Deregister(ctx context.Context) error {
+	s.Stop()
+	return s.reg.Deregister(ctx)
+}
@@ -0,0 +1,101 @@
+package selfcert
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/lstoll/grpce/helloproto"
+	"github.com/lstoll/grpce/kv"
+	"github.com/lstoll/grpce/registry"
+)
+
+// published returns the fingerprints of the certificates in a server's entry.
+func published(t *testing.T, store kv.Store, srv *Server) []string {
+	t.Helper()
+	o, err := store.Get(context.Background(), srv.Registration().Key())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e registry.Entry
+	if err := json.Unmarshal(o.Value, &e); err != nil {
+		t.Fatal(err)
+	}
+	var fps []string
+	for _, s := range e.Certificates {
+		c, err := ParsePEM(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fps = append(fps, Fingerprint(c))
+	}
+	return fps
+}
+
+func TestRotation(t *testing.T) {
+	ctx := context.Background()
+	store := kv.NewMemory()
+	srv, addr, stop := startServer(t, store, WithRotation(100*time.Millisecond, 30*time.Millisecond))
+	defer stop()
+
+	first := Fingerprint(srv.Certificate().Leaf)
+	// Certificate times are truncated to the second.
+	if got := srv.Certificate().Leaf.NotAfter.Sub(srv.Certificate().Leaf.NotBefore); got > 200*time.Millisecond+10*time.Minute+time.Second {
+		t.Errorf("want validity limited to the rotation, got %s", got)
+	}
+
+	creds := NewClientCredentials(store, "hello", WithMinRefresh(0))
+	conn, err := dial(addr, creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var (
+		sawOverlap bool
+		second     string
+	)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		fps := published(t, store, srv)
+		if len(fps) == 2 {
+			sawOverlap = true
+			if fps[0] != first {
+				t.Fatalf("want current certificate published during overlap, got %v", fps)
+			}
+		}
+		if len(fps) == 1 && fps[0] != first {
+			second = fps[0]
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Key never rotated")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if !sawOverlap {
+		t.Error("Never saw both certificates published")
+	}
+	if cur := Fingerprint(srv.Certificate().Leaf); cur != second {
+		t.Errorf("want server using the published certificate, got %s", cur)
+	}
+
+	// The connection made with the old key keeps working, and new ones use
+	// the new key.
+	if _, err := helloproto.NewHelloClient(conn).HelloWorld(ctx, &helloproto.HelloRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	conn2, err := dial(addr, creds)
+	if err != nil {
+		t.Fatalf("Dial after rotation: %v", err)
+	}
+	conn2.Close()
+}
+
+func TestRotationOptions(t *testing.T) {
+	_, err := NewServer(context.Background(), kv.NewMemory(), "hello", registry.Entry{}, WithRotation(time.Minute, time.Minute))
+	if err == nil {
+		t.Error("want error for an overlap longer than half the interval")
+	}
+}